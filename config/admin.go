@@ -0,0 +1,8 @@
+package config
+
+import "github.com/spf13/viper"
+
+// GetAdminToken returns the bearer token of the admin routes.
+func GetAdminToken() string {
+	return viper.GetString(EnvAdminToken)
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/olusolaa/go-backend/middleware"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+var apiVersions map[string]apiVersion
+
+// apiVersion lists its routes rather than keying them by route, since
+// viper lower cases map keys and route patterns such as
+// /outbound/{messageID} are case sensitive.
+type apiVersion struct {
+	Routes []RouteDeprecation
+}
+
+// RouteDeprecation is the retirement schedule of a single route, given by
+// its method and its chi pattern.
+type RouteDeprecation struct {
+	Method      string
+	Pattern     string
+	Deprecation time.Time
+	Sunset      time.Time
+	Link        string
+}
+
+// NewAPIVersions loads the per version route deprecations from api.yml.
+func NewAPIVersions() {
+	apiViper := viper.New()
+	apiViper.SetConfigName("api")
+	for _, path := range defaultDbConfigOpt.Paths {
+		apiViper.AddConfigPath(path)
+	}
+
+	if err := apiViper.ReadInConfig(); err != nil {
+		log.WithField("context", "api_versions_init").Panic(err)
+	}
+
+	err := apiViper.Unmarshal(&apiVersions, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+		mapstructure.StringToTimeDurationHookFunc(),
+	)))
+	if err != nil {
+		log.WithField("context", "api_versions_init").Panic(err)
+	}
+}
+
+// GetDeprecations returns the deprecated routes of version keyed by
+// "METHOD /pattern", as middleware.Version takes them.
+func GetDeprecations(version string) map[string]middleware.Deprecation {
+	routes := map[string]middleware.Deprecation{}
+	for _, d := range apiVersions[version].Routes {
+		routes[strings.ToUpper(d.Method)+" "+d.Pattern] = middleware.Deprecation{
+			Deprecation: d.Deprecation,
+			Sunset:      d.Sunset,
+			Link:        d.Link,
+		}
+	}
+	return routes
+}
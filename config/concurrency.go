@@ -0,0 +1,25 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+// GetConcurrencyLimit returns how many requests an account may have in
+// flight at once. It defaults to 10, well under the database pool, so a
+// single account cannot hold every connection.
+func GetConcurrencyLimit() int {
+	if limit := viper.GetInt(EnvConcurrencyLimit); limit > 0 {
+		return limit
+	}
+	return 10
+}
+
+// GetConcurrencyQueueTimeout returns how long a request over the
+// concurrency limit waits for another to finish before it is refused.
+func GetConcurrencyQueueTimeout() time.Duration {
+	if timeout := viper.GetDuration(EnvConcurrencyQueueTimeout); timeout > 0 {
+		return timeout
+	}
+	return 5 * time.Second
+}
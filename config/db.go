@@ -1,10 +1,13 @@
 package config
 
 import (
+	"database/sql"
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"os"
 
 	_ "github.com/jackc/pgx/stdlib"
@@ -100,11 +103,24 @@ func newDB(env string) (*sqlx.DB, error) {
 		}
 	}
 
-	db, err := sqlx.Connect(conn.Dialect, conn.URL)
+	// register a traced copy of the driver; sqlx still needs the original
+	// dialect name to pick the right bind type
+	driverName, err := otelsql.Register(conn.Dialect, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
 		return nil, err
 	}
 
+	sqlDB, err := sql.Open(driverName, conn.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sqlx.NewDb(sqlDB, conn.Dialect)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	//
 	if conn.Pool != 0 {
 		db.SetMaxOpenConns(conn.Pool)
@@ -3,4 +3,45 @@ package config
 const (
 	Env         = "ENV"
 	EnvRedisUrl = "REDIS_URL"
+
+	// EnvTraceExporter selects where spans are sent: "otlp", "stdout" or
+	// empty to disable exporting. The otlp exporter reads its endpoint from
+	// the standard OTEL_EXPORTER_OTLP_* variables.
+	EnvTraceExporter = "TRACE_EXPORTER"
+	EnvServiceName   = "OTEL_SERVICE_NAME"
+
+	EnvLogLevel       = "LOG_LEVEL"
+	EnvLogFormat      = "LOG_FORMAT"
+	EnvLogMessageText = "LOG_MESSAGE_TEXT"
+
+	EnvScheduleHorizon   = "SCHEDULE_HORIZON"
+	EnvSchedulerInterval = "SCHEDULER_INTERVAL"
+
+	EnvGRPCPort = "GRPC_PORT"
+
+	// EnvRateLimitAlgorithm selects how message limits are enforced:
+	// "sliding" (the default) or "gcra", which spaces messages evenly and
+	// lets RATE_LIMIT_BURST of them through at once.
+	EnvRateLimitAlgorithm = "RATE_LIMIT_ALGORITHM"
+	EnvRateLimitBurst     = "RATE_LIMIT_BURST"
+	// EnvRateLimitFailOpen lets messages through while redis or the plans
+	// cannot be reached, rather than refusing them with 503.
+	EnvRateLimitFailOpen = "RATE_LIMIT_FAIL_OPEN"
+
+	// EnvConcurrencyLimit caps the requests an account has in flight;
+	// requests over it wait up to CONCURRENCY_QUEUE_TIMEOUT for a slot.
+	EnvConcurrencyLimit        = "CONCURRENCY_LIMIT"
+	EnvConcurrencyQueueTimeout = "CONCURRENCY_QUEUE_TIMEOUT"
+
+	// EnvFraudHighCostCountries lists the destination countries, comma
+	// separated, whose sudden spikes count towards the fraud score.
+	EnvFraudHighCostCountries = "FRAUD_HIGH_COST_COUNTRIES"
+
+	EnvTrustedProxies = "TRUSTED_PROXIES"
+	EnvClientIPHeader = "CLIENT_IP_HEADER"
+	EnvIPv6Prefix     = "IPV6_PREFIX"
+
+	// EnvAdminToken is the bearer token of the admin routes, which are
+	// closed while it is unset.
+	EnvAdminToken = "ADMIN_TOKEN"
 )
@@ -0,0 +1,15 @@
+package config
+
+import (
+	"github.com/olusolaa/go-backend/pkg/fraud"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+// NewFraud applies FRAUD_HIGH_COST_COUNTRIES. Without it only numbers of
+// no country, such as satellite phones, are high-cost.
+func NewFraud() {
+	if countries := viper.GetString(EnvFraudHighCostCountries); countries != "" {
+		fraud.SetHighCostCountries(strings.Split(countries, ","))
+	}
+}
@@ -0,0 +1,11 @@
+package config
+
+import "github.com/spf13/viper"
+
+// GetGRPCPort returns the port the gRPC API listens on.
+func GetGRPCPort() string {
+	if port := viper.GetString(EnvGRPCPort); port != "" {
+		return port
+	}
+	return "9090"
+}
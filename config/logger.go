@@ -0,0 +1,36 @@
+package config
+
+import (
+	"github.com/olusolaa/go-backend/pkg"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// NewLogger configures the shared logrus logger from LOG_LEVEL and
+// LOG_FORMAT ("json" or "text"). Message text is only logged when
+// LOG_MESSAGE_TEXT is true.
+func NewLogger() {
+	log.SetOutput(os.Stdout)
+
+	level := viper.GetString(EnvLogLevel)
+	if level == "" {
+		level = "info"
+	}
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		log.WithField("context", "logger_init").Panic(err)
+	}
+	log.SetLevel(lvl)
+
+	switch format := viper.GetString(EnvLogFormat); format {
+	case "", "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	case "text":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	default:
+		log.WithField("context", "logger_init").Panicf("unknown log format %q", format)
+	}
+
+	pkg.SetLogMessageText(viper.GetBool(EnvLogMessageText))
+}
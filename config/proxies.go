@@ -0,0 +1,28 @@
+package config
+
+import (
+	"github.com/olusolaa/go-backend/middleware"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+// NewProxies applies TRUSTED_PROXIES, the comma separated addresses or
+// CIDRs of the proxies whose forwarding header is believed, CLIENT_IP_HEADER,
+// the one header they record the client in, and IPV6_PREFIX, the bits of an
+// IPv6 address clients are keyed by. Without them no proxy is trusted, so
+// behind a load balancer such as Heroku's router TRUSTED_PROXIES must be
+// set; the header defaults to X-Forwarded-For and IPv6 clients are keyed by
+// their /64.
+func NewProxies() {
+	if header := viper.GetString(EnvClientIPHeader); header != "" {
+		middleware.SetClientIPHeader(header)
+	}
+	if cidrs := viper.GetString(EnvTrustedProxies); cidrs != "" {
+		if err := middleware.SetTrustedProxies(strings.Split(cidrs, ",")); err != nil {
+			panic(err)
+		}
+	}
+	if bits := viper.GetInt(EnvIPv6Prefix); bits > 0 && bits <= 128 {
+		middleware.SetIPv6Prefix(bits)
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"strings"
+)
+
+const (
+	// RateLimitSliding counts requests in sliding windows.
+	RateLimitSliding = "sliding"
+	// RateLimitGCRA spaces requests evenly over their windows.
+	RateLimitGCRA = "gcra"
+)
+
+// GetRateLimitAlgorithm returns the algorithm message limits are enforced
+// with, RateLimitSliding unless RATE_LIMIT_ALGORITHM says otherwise.
+func GetRateLimitAlgorithm() string {
+	if strings.EqualFold(viper.GetString(EnvRateLimitAlgorithm), RateLimitGCRA) {
+		return RateLimitGCRA
+	}
+	return RateLimitSliding
+}
+
+// GetRateLimitFailOpen reports whether messages are let through while their
+// limits cannot be checked, as RATE_LIMIT_FAIL_OPEN asks. By default they
+// are refused with 503.
+func GetRateLimitFailOpen() bool {
+	return viper.GetBool(EnvRateLimitFailOpen)
+}
+
+// GetRateLimitBurst returns how many requests RateLimitGCRA lets through at
+// once after a quiet spell. It defaults to 1.
+func GetRateLimitBurst() int {
+	if burst := viper.GetInt(EnvRateLimitBurst); burst > 0 {
+		return burst
+	}
+	return 1
+}
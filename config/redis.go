@@ -1,7 +1,9 @@
 package config
 
 import (
-	"github.com/go-redis/redis"
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/olusolaa/go-backend/pkg"
 	log "github.com/sirupsen/logrus"
 	"os"
 )
@@ -18,8 +20,9 @@ func NewRedis() {
 	}
 
 	redisClient = redis.NewClient(opt)
+	redisClient.AddHook(pkg.RedisTracer{})
 
-	_, err = redisClient.Ping().Result()
+	_, err = redisClient.Ping(context.Background()).Result()
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// NewScheduling applies SCHEDULE_HORIZON, the furthest ahead a message may
+// be scheduled. It defaults to a week.
+func NewScheduling() {
+	if horizon := viper.GetDuration(EnvScheduleHorizon); horizon > 0 {
+		pkg.SetScheduleHorizon(horizon)
+	}
+}
+
+// GetSchedulerInterval returns how often due messages are polled for.
+func GetSchedulerInterval() time.Duration {
+	if interval := viper.GetDuration(EnvSchedulerInterval); interval > 0 {
+		return interval
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"os"
+)
+
+const defaultServiceName = "go-backend"
+
+func newTraceExporter(kind string) (sdktrace.SpanExporter, error) {
+	switch kind {
+	case "otlp":
+		return otlptracehttp.New(context.Background())
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "":
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unknown trace exporter %q", kind)
+	}
+}
+
+// NewTracer installs the global tracer provider and the W3C trace context
+// propagator. Spans are only exported when TRACE_EXPORTER is set.
+func NewTracer() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exp, err := newTraceExporter(os.Getenv(EnvTraceExporter))
+	if err != nil {
+		log.WithField("context", "tracer_init").Panic(err)
+	}
+	if exp == nil {
+		return
+	}
+
+	serviceName := os.Getenv(EnvServiceName)
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.DeploymentEnvironmentKey.String(os.Getenv(Env)),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	closeFn := func() {
+		log.Info("flushing traces")
+
+		err := tp.Shutdown(context.Background())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"context": "close_tracer",
+				"method":  "config/close",
+			}).Error(err)
+		}
+	}
+
+	closeFns = append(closeFns, closeFn)
+}
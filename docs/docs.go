@@ -0,0 +1,135 @@
+// Package docs serves the OpenAPI document describing the HTTP API along
+// with an interactive swagger UI.
+package docs
+
+import (
+	_ "embed"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	httpSwagger "github.com/swaggo/http-swagger"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Path is where Router is expected to be mounted.
+const Path = "/docs"
+
+//go:embed openapi.yaml
+var spec []byte
+
+var (
+	httpMethods = map[string]bool{
+		"get": true, "put": true, "post": true, "delete": true,
+		"options": true, "head": true, "patch": true, "trace": true,
+	}
+	// chi allows {id:[0-9]+}, openapi only {id}
+	paramPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+)
+
+// Spec returns the raw OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// Router serves the spec at /openapi.yaml and the UI at /index.html.
+func Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, Path+"/index.html", http.StatusMovedPermanently)
+	})
+	r.Get("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(spec)
+	})
+	r.Get("/*", httpSwagger.Handler(httpSwagger.URL(Path+"/openapi.yaml")))
+
+	return r
+}
+
+type document struct {
+	Paths map[string]map[string]interface{} `yaml:"paths"`
+}
+
+// pathServers holds the servers of the paths that override the spec's
+// own, such as the admin routes served outside the API prefix.
+type pathServers struct {
+	Paths map[string]struct {
+		Servers []struct {
+			URL string `yaml:"url"`
+		} `yaml:"servers"`
+	} `yaml:"paths"`
+}
+
+// Operations returns the "METHOD /path" pairs described by the spec, with
+// paths prefixed by prefix, or by their own server when they have one.
+func Operations(prefix string) ([]string, error) {
+	var doc document
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, errors.Wrap(err, "parse openapi spec")
+	}
+	var servers pathServers
+	if err := yaml.Unmarshal(spec, &servers); err != nil {
+		return nil, errors.Wrap(err, "parse openapi spec")
+	}
+
+	var ops []string
+	for path, item := range doc.Paths {
+		base := prefix
+		if own := servers.Paths[path].Servers; len(own) > 0 {
+			base = strings.TrimSuffix(own[0].URL, "/")
+		}
+		for method := range item {
+			if httpMethods[method] {
+				ops = append(ops, strings.ToUpper(method)+" "+base+path)
+			}
+		}
+	}
+	sort.Strings(ops)
+	return ops, nil
+}
+
+// CheckRoutes compares the routes registered on r under prefix, and under
+// any of roots, with the operations in the spec and reports any that only
+// appear on one side.
+func CheckRoutes(r chi.Routes, prefix string, roots ...string) error {
+	documented, err := Operations(prefix)
+	if err != nil {
+		return err
+	}
+
+	roots = append([]string{prefix}, roots...)
+	registered := map[string]bool{}
+	err = chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = paramPattern.ReplaceAllString(strings.TrimSuffix(route, "/"), "{$1}")
+		for _, root := range roots {
+			if strings.HasPrefix(route, root+"/") {
+				registered[method+" "+route] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing, undocumented []string
+	for _, op := range documented {
+		if !registered[op] {
+			missing = append(missing, op)
+		}
+		delete(registered, op)
+	}
+	for op := range registered {
+		undocumented = append(undocumented, op)
+	}
+	sort.Strings(undocumented)
+
+	if len(missing) == 0 && len(undocumented) == 0 {
+		return nil
+	}
+	return errors.Errorf("openapi spec out of date: not routed %v, not documented %v", missing, undocumented)
+}
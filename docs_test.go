@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/olusolaa/go-backend/docs"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"testing"
+	"time"
+)
+
+// TestRoutesDocumented checks that docs/openapi.yaml describes every route
+// of the API and of the admin routes, and nothing else.
+func TestRoutesDocumented(t *testing.T) {
+	r, ok := initRouter(middleware2.NewRateLimiter(1, time.Hour), nil, nil).(chi.Routes)
+	if !ok {
+		t.Fatal("router does not expose its routes")
+	}
+	if err := docs.CheckRoutes(r, "/api/v1", "/admin"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,17 +7,32 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	"github.com/olusolaa/go-backend/config"
+	"github.com/olusolaa/go-backend/docs"
 	middleware2 "github.com/olusolaa/go-backend/middleware"
 	"github.com/olusolaa/go-backend/pkg"
 	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/olusolaa/go-backend/pkg/allowlist"
+	"github.com/olusolaa/go-backend/pkg/campaigns"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/conversations"
+	"github.com/olusolaa/go-backend/pkg/destinations"
+	"github.com/olusolaa/go-backend/pkg/events"
+	"github.com/olusolaa/go-backend/pkg/fraud"
 	"github.com/olusolaa/go-backend/pkg/inbounds"
 	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/ratelimits"
+	"github.com/olusolaa/go-backend/pkg/rpc"
+	"github.com/olusolaa/go-backend/pkg/rules"
+	"github.com/olusolaa/go-backend/pkg/templates"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -27,13 +42,62 @@ func main() {
 	viper.AutomaticEnv()
 
 	config.New(
-		config.NewDB,    // postgres
-		config.NewRedis, //redis
+		config.NewLogger, // logrus
+		config.NewTracer, // opentelemetry
+		config.NewDB,     // postgres
+		config.NewRedis,  //redis
+		config.NewAPIVersions,
+		config.NewScheduling,
+		config.NewProxies, // client addresses behind the router
+		config.NewFraud,
 	)
 
 	//init account_client
 
-	r := initRouter()
+	// shared by the /sms routes, the scheduler and campaigns so every
+	// message counts against the same limits, those of its account's plan.
+	// Plans are cached for a minute, so edits to them apply without a
+	// redeploy. Counts are kept in redis so every dyno shares them.
+	plans := account.NewPlanCache(account.NewRepository(config.GetDB(), config.GetRedis()), time.Minute)
+	limitOptions := []middleware2.Option{
+		middleware2.WithLimitCounter(middleware2.NewRedisLimitCounter(config.GetRedis(), "ratelimit:", 48*time.Hour)),
+		middleware2.WithBoosts(middleware2.NewRedisBoosts(config.GetRedis(), "ratelimit:boost:")),
+		middleware2.WithFailOpen(config.GetRateLimitFailOpen()),
+		middleware2.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusTooManyRequests,
+				errors.Errorf(`limit reached for from %s`, pkg.GetDecodedPostRequest(r.Context()).From)))
+		}),
+	}
+	if config.GetRateLimitAlgorithm() == config.RateLimitGCRA {
+		limitOptions = append(limitOptions, middleware2.WithAlgorithm(
+			middleware2.RedisGCRA(config.GetRedis(), "ratelimit:gcra:", config.GetRateLimitBurst()),
+		))
+	}
+	limiter := middleware2.NewPlanLimiter(plans.Find, limitOptions...)
+
+	// fans message events out to the streams open on this dyno
+	hub := events.NewHub(config.GetRedis())
+
+	r := initRouter(limiter, hub, limiter)
+
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	var schedulers sync.WaitGroup
+	scheduler := outbounds.NewScheduler(config.GetDB(), config.GetRedis(), limiter, config.GetSchedulerInterval())
+	runner := campaigns.NewRunner(config.GetDB(), config.GetRedis(), limiter, config.GetSchedulerInterval())
+	schedulers.Add(3)
+	go func() {
+		defer schedulers.Done()
+		scheduler.Run(schedCtx)
+	}()
+	go func() {
+		defer schedulers.Done()
+		runner.Run(schedCtx)
+	}()
+	go func() {
+		defer schedulers.Done()
+		// stopping the hub also ends the open streams
+		hub.Run(schedCtx)
+	}()
 
 	port := "8080"
 	envPort := os.Getenv("PORT")
@@ -42,12 +106,28 @@ func main() {
 	}
 
 	srv := http.Server{
-		Addr:         ":" + port,
-		Handler:      http.TimeoutHandler(r, time.Minute, "server timed out"),
+		Addr: ":" + port,
+		Handler: middleware2.Unless(isStream, func(h http.Handler) http.Handler {
+			return http.TimeoutHandler(h, time.Minute, "server timed out")
+		})(r),
 		ReadTimeout:  time.Minute,
 		WriteTimeout: time.Minute,
 	}
 
+	// internal services call the same API over gRPC on a port of its own
+	grpcSrv := rpc.NewServer(config.GetDB(), config.GetRedis(), limiter, hub)
+	grpcPort := config.GetGRPCPort()
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.WithError(err).WithField("port", grpcPort).Fatal("unable to listen for grpc")
+	}
+	go func() {
+		log.WithField("port", grpcPort).Info("grpc server started")
+		if err := grpcSrv.Serve(lis); err != nil {
+			log.WithError(err).Error("grpc server stopped")
+		}
+	}()
+
 	var gracefulStop = make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
@@ -56,37 +136,50 @@ func main() {
 
 	go func() {
 		sig := <-gracefulStop
-		log.Printf("caught sig : %+v", sig)
+		log.WithField("signal", sig.String()).Info("caught signal")
 
 		srv.RegisterOnShutdown(func() {
 			// engine.Quit(cancel)
+			stopScheduler()
+			// streams end with the hub, so this only waits for unary calls
+			grpcSrv.GracefulStop()
+			schedulers.Wait()
 			config.Close()
 			cancel()
 		})
-		log.Println("ENDED", srv.Shutdown(ctx))
+		if err := srv.Shutdown(ctx); err != nil {
+			log.WithField("context", "server_shutdown").Error(err)
+		}
 	}()
 
-	log.Println("server started on port ", port)
+	log.WithField("port", port).Info("server started")
 	if err := srv.ListenAndServe(); err != nil {
-		log.Println("closing the server", err)
+		log.WithError(err).Info("closing the server")
 		if err == http.ErrServerClosed {
 			select {
 			case <-ctx.Done():
-				log.Println("Server closed")
+				log.Info("server closed")
 			}
 		}
 	}
 }
 
-func initRouter() http.Handler {
+// isStream reports whether r opens a message stream. Streams stay open for
+// as long as the client listens and bound each write themselves, so they
+// skip the request timeouts.
+func isStream(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/inbound/stream")
+}
+
+func initRouter(limiter outbounds.Limiter, hub *events.Hub, limits ratelimits.Limiter) http.Handler {
 	r := chi.NewRouter()
 	timeoutDuration := time.Second * 25
 
 	c := cors.New(cors.Options{
 		AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"POST"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "traceparent", "tracestate", "Idempotency-Key", "Last-Event-ID"},
+		ExposedHeaders:   []string{"Link", "API-Version", "Deprecation", "Sunset", "Idempotent-Replayed", "Retry-After", "RateLimit", "RateLimit-Policy", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})
@@ -94,12 +187,13 @@ func initRouter() http.Handler {
 	r.Use(c.Handler)
 	r.Use(middleware.Recoverer)
 
-	r.Use(middleware.AllowContentType("application/json", "multipart/form-data", ""))
+	r.Use(middleware.AllowContentType("application/json", "multipart/form-data", "text/csv", ""))
 	r.Use(middleware.RequestID)
-	r.Use(func(handler http.Handler) http.Handler {
+	r.Use(middleware2.Trace("go-backend"))
+	r.Use(middleware2.RequestLogger)
+	r.Use(middleware2.Unless(isStream, func(handler http.Handler) http.Handler {
 		return http.TimeoutHandler(handler, timeoutDuration, `{"status":"timeout error", "message":"unable to process request at the moment. Try again"}`)
-	})
-	r.Use(middleware.Logger)
+	}))
 	//wrap the response writer to allow more info
 	r.Use(func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -111,7 +205,7 @@ func initRouter() http.Handler {
 			h.ServeHTTP(ww, r)
 		})
 	})
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(middleware2.Unless(isStream, middleware.Timeout(60*time.Second)))
 
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("Welcome to go backend"))
@@ -120,28 +214,66 @@ func initRouter() http.Handler {
 		}
 	})
 
-	r.Route("/api", func(r chi.Router) {
-		db := config.GetDB()
-		rd := config.GetRedis()
-
-		_, _ = db, rd
-
-		accRep := account.NewRepository(db, rd)
-		r.Use(middleware2.BasicAuth(accRep.FindByUsername))
-		r.Use(pkg.DecodePostRequest())
-		r.Use(middleware2.Limit(
-			50,           // requests
-			24*time.Hour, // per duration,
-			middleware2.WithKeyFuncs(middleware2.KeyByIP, middleware2.KeyByFrom),
-			middleware2.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
-				pkg.Render(w, r, errors.Errorf(`limit reached for from %s`, pkg.GetDecodedPostRequest().From))
-			}),
-		))
-		inboundRouter := inbounds.NewResource(db, rd)
-		outboundRouter := outbounds.NewResource(db, rd)
-		r.Mount("/inbound", inboundRouter.Router())
-		r.Mount("/outbound", outboundRouter.Router())
-	})
+	v1 := apiV1Router(limiter, hub)
+	r.Mount("/api/v1", v1)
+	r.Mount("/api", v1) // unversioned alias kept for existing clients
+
+	r.Mount(docs.Path, docs.Router())
+
+	// support inspects and resets the limits of customers with an admin
+	// token, not account credentials
+	r.With(middleware2.AdminAuth(config.GetAdminToken())).
+		Mount("/admin/ratelimits", ratelimits.NewResource(config.GetDB(), config.GetRedis(), limits).Router())
+	// the destination policy of accounts that have not set their own
+	r.With(middleware2.AdminAuth(config.GetAdminToken())).
+		Mount("/admin/destinations", destinations.NewResource(config.GetDB(), config.GetRedis()).AdminRouter())
+	// reviewers set fraud policies and release or drop held messages
+	r.With(middleware2.AdminAuth(config.GetAdminToken())).
+		Mount("/admin/fraud", fraud.NewResource(config.GetDB(), config.GetRedis()).Router())
+	r.With(middleware2.AdminAuth(config.GetAdminToken())).
+		Mount("/admin/messages", outbounds.NewResource(config.GetDB(), config.GetRedis(), limiter).AdminRouter())
+
+	return r
+}
+
+func apiV1Router(limiter outbounds.Limiter, hub *events.Hub) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware2.Version("v1", config.GetDeprecations("v1")))
+
+	db := config.GetDB()
+	rd := config.GetRedis()
+
+	_, _ = db, rd
+
+	accRep := account.NewRepository(db, rd)
+	r.Use(middleware2.BasicAuth(accRep.FindByUsername))
+	// accounts with an allowlist are only served from its addresses
+	r.Use(middleware2.IPAllowlist(allowlist.NewService(allowlist.NewRepository(db, rd)).Allows))
+	// caps the requests of each account in flight across dynos, so one
+	// account's slow batch cannot hold the whole database pool. Slots are
+	// leased past the longest request timeout in case a dyno dies.
+	r.Use(middleware2.Unless(isStream, middleware2.LimitConcurrency(config.GetConcurrencyLimit(),
+		middleware2.WithSemaphore(middleware2.NewRedisSemaphore(rd, "inflight:", 2*time.Minute)),
+		middleware2.WithQueueTimeout(config.GetConcurrencyQueueTimeout()),
+	)))
+	r.Use(middleware2.Idempotency(
+		middleware2.NewRedisIdempotencyStore(rd, "idempotency:"),
+		24*time.Hour,
+	))
+
+	// decoding and rate limiting happen per route: batch sends carry a
+	// different body and consume the limit once per message
+	inboundRouter := inbounds.NewResource(db, rd, limiter, hub)
+	outboundRouter := outbounds.NewResource(db, rd, limiter)
+	r.Mount("/inbound", inboundRouter.Router())
+	r.Mount("/outbound", outboundRouter.Router())
+	r.Mount("/templates", templates.NewResource(db, rd).Router())
+	r.Mount("/contacts", contacts.NewResource(db, rd).Router())
+	r.Mount("/campaigns", campaigns.NewResource(db, rd).Router())
+	r.Mount("/conversations", conversations.NewResource(db, rd).Router())
+	r.Mount("/rules", rules.NewResource(db, rd).Router())
+	r.Mount("/allowlist", allowlist.NewResource(db, rd).Router())
+	r.Mount("/destinations", destinations.NewResource(db, rd).Router())
 
 	return r
 }
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth lets through requests bearing token as "Authorization: Bearer".
+// It is separate from the account credentials of BasicAuth; with an empty
+// token every request is refused, so the admin routes stay closed until
+// one is configured.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				pkg.Logger(r.Context()).Warn("admin auth: invalid token")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				pkg.Render(w, r, pkg.WithStatus(http.StatusUnauthorized, errors.New("unauthorized")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
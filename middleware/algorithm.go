@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Algorithm decides whether requests fit their limits.
+type Algorithm interface {
+	// Take returns the state of each take at now and, if every one of
+	// them allows the request, counts it against all of them as one step.
+	Take(ctx context.Context, now time.Time, takes []Take) ([]State, bool, error)
+	// Peek returns the state of each take at now without counting a
+	// request.
+	Peek(ctx context.Context, now time.Time, takes []Take) ([]State, error)
+	// Reset forgets the requests counted against each take.
+	Reset(ctx context.Context, now time.Time, takes []Take) error
+}
+
+// ErrNoReset is returned by Reset when the counter cannot forget counts.
+var ErrNoReset = errors.New("limit counter cannot be reset")
+
+// State is where a request leaves one limit.
+type State struct {
+	Limit     int
+	Remaining int
+	// Reset is when the limit is next replenished.
+	Reset time.Time
+	// RetryAfter is how long until the limit lets a request through, 0
+	// when it let this one through.
+	RetryAfter time.Duration
+}
+
+func (s State) retryAfterSeconds() int {
+	return int(math.Ceil(s.RetryAfter.Seconds()))
+}
+
+// SlidingWindow is the default algorithm. It estimates the requests of the
+// last window length from the counts of counter's current and previous
+// fixed windows, weighting the previous one by how much of it the sliding
+// window still covers.
+func SlidingWindow(counter LimitCounter) Algorithm {
+	return &slidingWindow{counter: counter}
+}
+
+type slidingWindow struct {
+	counter LimitCounter
+
+	// serialises takes for counters that are not MultiCounters
+	mu sync.Mutex
+}
+
+func (a *slidingWindow) Take(ctx context.Context, now time.Time, takes []Take) ([]State, bool, error) {
+	counts, ok, err := a.takeAll(ctx, now, takes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	states := make([]State, len(takes))
+	for i, t := range takes {
+		states[i] = slidingState(now, t, counts[i], ok)
+	}
+	return states, ok, nil
+}
+
+func (a *slidingWindow) Peek(ctx context.Context, now time.Time, takes []Take) ([]State, error) {
+	states := make([]State, len(takes))
+	for i, t := range takes {
+		currentWindow := now.Truncate(t.Length)
+		curr, prev, err := a.counter.Get(ctx, t.Key, currentWindow, currentWindow.Add(-t.Length))
+		if err != nil {
+			return nil, err
+		}
+		states[i] = slidingState(now, t, Counts{Curr: curr, Prev: prev}, false)
+	}
+	return states, nil
+}
+
+func (a *slidingWindow) Reset(ctx context.Context, now time.Time, takes []Take) error {
+	rc, ok := a.counter.(ResetCounter)
+	if !ok {
+		return ErrNoReset
+	}
+	for _, t := range takes {
+		currentWindow := now.Truncate(t.Length)
+		if err := rc.Reset(ctx, t.Key, currentWindow, currentWindow.Add(-t.Length)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slidingState is the state of t with the counts c from before the
+// request, which counted tells whether it was counted.
+func slidingState(now time.Time, t Take, c Counts, counted bool) State {
+	s := State{Limit: t.Limit}
+	switch {
+	case c.rate(now, t.Length) >= t.Limit:
+		s.RetryAfter = slidingRetryAfter(now, t, c.Curr, c.Prev)
+	case counted:
+		c.Curr++
+		fallthrough
+	default:
+		if rate := c.rate(now, t.Length); rate < t.Limit {
+			s.Remaining = t.Limit - rate
+		}
+	}
+	s.Reset = slidingReset(now, t.Length, c)
+	return s
+}
+
+func (a *slidingWindow) takeAll(ctx context.Context, now time.Time, takes []Take) ([]Counts, bool, error) {
+	if mc, ok := a.counter.(MultiCounter); ok {
+		return mc.TakeAll(ctx, now, takes)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	counts := make([]Counts, len(takes))
+	ok := true
+	for i, t := range takes {
+		currentWindow := now.Truncate(t.Length)
+		curr, prev, err := a.counter.Get(ctx, t.Key, currentWindow, currentWindow.Add(-t.Length))
+		if err != nil {
+			return nil, false, err
+		}
+		counts[i] = Counts{Curr: curr, Prev: prev}
+		if counts[i].rate(now, t.Length) >= t.Limit {
+			ok = false
+		}
+	}
+	if !ok {
+		return counts, false, nil
+	}
+
+	for _, t := range takes {
+		if err := a.counter.Increment(ctx, t.Key, now.Truncate(t.Length)); err != nil {
+			return nil, false, err
+		}
+	}
+	return counts, true, nil
+}
+
+// slidingReset is when the counts c have slid out of the window entirely:
+// the end of the next window for requests of this one, the end of this
+// window for requests of the previous one.
+func slidingReset(now time.Time, length time.Duration, c Counts) time.Time {
+	currentWindow := now.Truncate(length)
+	switch {
+	case c.Curr > 0:
+		return currentWindow.Add(2 * length)
+	case c.Prev > 0:
+		return currentWindow.Add(length)
+	}
+	return now
+}
+
+// slidingRetryAfter is how long from now until the rounded sliding rate of
+// the counts curr and prev drops below the limit of t, with no requests in
+// between. It is rounded up so that a client never retries too early.
+func slidingRetryAfter(now time.Time, t Take, curr, prev int) time.Duration {
+	currentWindow := now.Truncate(t.Length)
+	target := float64(t.Limit) - 0.5
+
+	var at time.Time
+	if float64(curr) < target {
+		// later in this window, once enough of the previous one slid out
+		elapsed := float64(t.Length) * (1 - (target-float64(curr))/float64(prev))
+		at = currentWindow.Add(time.Duration(math.Ceil(elapsed)))
+	} else {
+		// in the next window, where curr becomes the previous count
+		elapsed := float64(t.Length) * (1 - target/float64(curr))
+		at = currentWindow.Add(t.Length + time.Duration(math.Ceil(elapsed)))
+	}
+
+	if d := at.Sub(now); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// t0 is half way through a minute, so the previous minute still weighs 0.5
+// in the sliding window.
+var t0 = time.Date(2026, 1, 1, 12, 0, 30, 0, time.UTC)
+
+func TestSlidingWindowTake(t *testing.T) {
+	minute := Take{Key: "k", Limit: 3, Length: time.Minute}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		// prev and curr are the counts of the previous and current minute
+		// before the take
+		prev, curr int
+		want       State
+		wantOK     bool
+	}{
+		{
+			name:   "first request",
+			now:    t0,
+			want:   State{Limit: 3, Remaining: 2, Reset: t0.Truncate(time.Minute).Add(2 * time.Minute)},
+			wantOK: true,
+		},
+		{
+			name:   "last request of the limit",
+			now:    t0,
+			curr:   2,
+			want:   State{Limit: 3, Remaining: 0, Reset: t0.Truncate(time.Minute).Add(2 * time.Minute)},
+			wantOK: true,
+		},
+		{
+			// 3 this minute slide below 2.5 once 1/6 of the next one passed
+			name: "at the limit",
+			now:  t0,
+			curr: 3,
+			want: State{Limit: 3, Reset: t0.Truncate(time.Minute).Add(2 * time.Minute), RetryAfter: 40 * time.Second},
+		},
+		{
+			// 6 * 0.5 rounds to the limit; 6 * 0.4 would not
+			name: "at the limit from the previous window",
+			now:  t0,
+			prev: 6,
+			want: State{Limit: 3, Reset: t0.Truncate(time.Minute).Add(time.Minute), RetryAfter: 5 * time.Second},
+		},
+		{
+			name:   "previous window rounded down",
+			now:    t0.Add(5 * time.Second),
+			prev:   5,
+			want:   State{Limit: 3, Remaining: 0, Reset: t0.Truncate(time.Minute).Add(2 * time.Minute)},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			counter := newLocalCounter(time.Minute)
+			window := tt.now.Truncate(time.Minute)
+			for i := 0; i < tt.prev; i++ {
+				counter.Increment(ctx, minute.Key, window.Add(-time.Minute))
+			}
+			for i := 0; i < tt.curr; i++ {
+				counter.Increment(ctx, minute.Key, window)
+			}
+
+			states, ok, err := SlidingWindow(counter).Take(ctx, tt.now, []Take{minute})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if states[0] != tt.want {
+				t.Errorf("state = %+v, want %+v", states[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       int
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+		{4800 * time.Millisecond, 5},
+	}
+	for _, tt := range tests {
+		if got := (State{RetryAfter: tt.retryAfter}).retryAfterSeconds(); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v) = %d, want %d", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestSlidingRetryAfterRoundsUp(t *testing.T) {
+	// 6 in the previous minute drop below 2.5 at 35s, 4.8s after now
+	now := t0.Add(200 * time.Millisecond)
+	d := slidingRetryAfter(now, Take{Limit: 3, Length: time.Minute}, 0, 6)
+	if d != 4800*time.Millisecond {
+		t.Fatalf("retry after %v, want 4.8s", d)
+	}
+	if s := (State{RetryAfter: d}).retryAfterSeconds(); s != 5 {
+		t.Errorf("Retry-After %d, want 5", s)
+	}
+}
+
+func TestGCRATake(t *testing.T) {
+	// a request a second, up to 3 at once
+	take := Take{Key: "k", Limit: 10, Length: 10 * time.Second}
+
+	tests := []struct {
+		name  string
+		burst int
+		// at are the times of the requests, the last one checked
+		at     []time.Duration
+		want   State
+		wantOK bool
+	}{
+		{
+			name:   "first request",
+			burst:  3,
+			at:     []time.Duration{0},
+			want:   State{Limit: 10, Remaining: 2, Reset: t0.Add(time.Second)},
+			wantOK: true,
+		},
+		{
+			name:   "burst used up",
+			burst:  3,
+			at:     []time.Duration{0, 0, 0},
+			want:   State{Limit: 10, Remaining: 0, Reset: t0.Add(3 * time.Second)},
+			wantOK: true,
+		},
+		{
+			name:  "over the burst",
+			burst: 3,
+			at:    []time.Duration{0, 0, 0, 0},
+			want:  State{Limit: 10, Reset: t0.Add(3 * time.Second), RetryAfter: time.Second},
+		},
+		{
+			name:   "after one interval",
+			burst:  3,
+			at:     []time.Duration{0, 0, 0, time.Second},
+			want:   State{Limit: 10, Remaining: 0, Reset: t0.Add(4 * time.Second)},
+			wantOK: true,
+		},
+		{
+			name:   "no burst spaces requests",
+			burst:  0,
+			at:     []time.Duration{0, 999 * time.Millisecond},
+			want:   State{Limit: 10, Reset: t0.Add(time.Second), RetryAfter: time.Millisecond},
+			wantOK: false,
+		},
+		{
+			name:   "burst capped at the limit",
+			burst:  20,
+			at:     []time.Duration{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			want:   State{Limit: 10, Remaining: 0, Reset: t0.Add(10 * time.Second)},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			alg := GCRA(tt.burst)
+
+			var states []State
+			var ok bool
+			var err error
+			for _, d := range tt.at {
+				if states, ok, err = alg.Take(ctx, t0.Add(d), []Take{take}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if states[0] != tt.want {
+				t.Errorf("state = %+v, want %+v", states[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestTakeAllOrNothing(t *testing.T) {
+	takes := []Take{
+		{Key: "minute", Limit: 1, Length: time.Minute},
+		{Key: "hour", Limit: 5, Length: time.Hour},
+	}
+
+	algorithms := []struct {
+		name string
+		alg  func() Algorithm
+	}{
+		{"sliding window", func() Algorithm { return SlidingWindow(newLocalCounter(time.Hour)) }},
+		{"sliding window, single counts", func() Algorithm { return SlidingWindow(singleCounter{newLocalCounter(time.Hour)}) }},
+		{"gcra", func() Algorithm { return GCRA(5) }},
+	}
+
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			ctx := context.Background()
+			alg := a.alg()
+
+			if _, ok, err := alg.Take(ctx, t0, takes); err != nil || !ok {
+				t.Fatalf("first take: ok = %v, err = %v", ok, err)
+			}
+			states, ok, err := alg.Take(ctx, t0, takes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				t.Fatal("second take within the minute was let through")
+			}
+			if states[0].RetryAfter == 0 {
+				t.Errorf("minute state %+v, want a retry after", states[0])
+			}
+
+			// the refused take was not counted against the hour
+			states, err = alg.Peek(ctx, t0, takes[1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if states[0].Remaining != 4 {
+				t.Errorf("hour remaining %d, want 4", states[0].Remaining)
+			}
+		})
+	}
+}
+
+// singleCounter hides the TakeAll of a counter, as a LimitCounter of
+// another package would.
+type singleCounter struct {
+	c *localCounter
+}
+
+func (s singleCounter) Increment(ctx context.Context, key string, currentWindow time.Time) error {
+	return s.c.Increment(ctx, key, currentWindow)
+}
+
+func (s singleCounter) Get(ctx context.Context, key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return s.c.Get(ctx, key, currentWindow, previousWindow)
+}
+
+func TestPolicyAllowAllOrNothing(t *testing.T) {
+	p := NewPolicy([]Window{
+		{Name: "minute", Limit: 1, Length: time.Minute},
+		{Name: "day", Limit: 5, Length: 24 * time.Hour},
+	})
+	r := httptest.NewRequest(http.MethodPost, "/outbound/sms", nil)
+
+	if ok, err := p.Allow(r); err != nil || !ok {
+		t.Fatalf("first request: ok = %v, err = %v", ok, err)
+	}
+	if ok, err := p.Allow(r); err != nil || ok {
+		t.Fatalf("second request: ok = %v, err = %v, want it limited", ok, err)
+	}
+
+	usage, err := p.Usage(r, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Remaining != 4 {
+		t.Errorf("day usage %+v, want 4 remaining", usage)
+	}
+}
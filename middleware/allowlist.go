@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// IPAllowlist refuses the requests of an account that come from outside
+// its allowlist. It runs after BasicAuth, which names the account, and
+// fails closed: a failed lookup refuses the request too. The address is
+// taken from r.RemoteAddr, or from the client IP header only when that was
+// set by one of the configured trusted proxies (see ClientIP), so a client
+// cannot name an allowed address itself.
+func IPAllowlist(allows func(ctx context.Context, accountId int64, ip string) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accountId := pkg.AccountID(r.Context())
+			ip := ClientIP(r)
+
+			ok, err := allows(r.Context(), accountId, ip)
+			if err != nil {
+				pkg.Logger(r.Context()).WithError(err).Error("ip allowlist: lookup failed")
+				pkg.Render(w, r, errors.Wrap(err, "ip allowlist"))
+				return
+			}
+			if !ok {
+				pkg.Logger(r.Context()).WithField("account_id", accountId).WithField("client_ip", ip).
+					Warn("ip allowlist: address not allowed")
+				pkg.Render(w, r, pkg.WithStatus(http.StatusForbidden,
+					errors.Errorf("address %s is not on the account's allowlist", ip)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
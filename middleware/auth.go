@@ -1,13 +1,15 @@
 package middleware
 
 import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
 	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 )
 
-var authUserId int64
-
-func BasicAuth(findUserByEmail func(string) (*account.Account, error)) func(http.Handler) http.Handler {
+func BasicAuth(findUserByEmail func(context.Context, string) (*account.Account, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, pass, ok := r.BasicAuth()
@@ -17,23 +19,22 @@ func BasicAuth(findUserByEmail func(string) (*account.Account, error)) func(http
 				w.Write([]byte("403 Unauthorized\n"))
 				return
 			}
-			acc, err := findUserByEmail(user)
+			acc, err := findUserByEmail(r.Context(), user)
 			if err != nil {
+				pkg.Logger(r.Context()).WithError(err).Warn("basic auth: account lookup failed")
 				w.WriteHeader(403)
 				w.Write([]byte("403 Unauthorized\n"))
 				return
 			}
 			if acc.AuthId != pass {
+				pkg.Logger(r.Context()).WithField("account_id", acc.ID).Warn("basic auth: invalid credentials")
 				w.WriteHeader(403)
 				w.Write([]byte("403 Unauthorized\n"))
 				return
 			}
-			authUserId = acc.ID
-			next.ServeHTTP(w, r)
+			trace.SpanFromContext(r.Context()).SetAttributes(pkg.AttrAccountID.Int64(acc.ID))
+			pkg.AddLogFields(r.Context(), logrus.Fields{"account_id": acc.ID})
+			next.ServeHTTP(w, r.WithContext(pkg.WithAccountID(r.Context(), acc.ID)))
 		})
 	}
 }
-
-func GetAuthUserId() int64 {
-	return authUserId
-}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// Boosts are temporary additions to the limit of some limiter keys, such
+// as a few more messages for a customer who hit a daily cap by mistake.
+type Boosts interface {
+	// Extra returns the boost of each key, 0 for none.
+	Extra(ctx context.Context, keys []string) ([]int, error)
+	// Grant adds extra to the limit of key until the given time. An extra
+	// of 0 or less withdraws the boost of key.
+	Grant(ctx context.Context, key string, extra int, until time.Time) error
+}
+
+// WithBoosts adds the boosts of b to the limits of the limiter.
+func WithBoosts(b Boosts) Option {
+	return func(rl *rateLimiter) {
+		rl.boosts = b
+	}
+}
+
+type redisBoosts struct {
+	rd     *redis.Client
+	prefix string
+}
+
+var _ Boosts = redisBoosts{}
+
+// NewRedisBoosts keeps boosts in redis under prefix, each expiring when it
+// ends.
+func NewRedisBoosts(rd *redis.Client, prefix string) Boosts {
+	return redisBoosts{rd: rd, prefix: prefix}
+}
+
+func (b redisBoosts) Extra(ctx context.Context, keys []string) ([]int, error) {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = b.prefix + k
+	}
+	values, err := b.rd.MGet(ctx, names...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	extra := make([]int, len(keys))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			if extra[i], err = strconv.Atoi(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return extra, nil
+}
+
+func (b redisBoosts) Grant(ctx context.Context, key string, extra int, until time.Time) error {
+	ttl := time.Until(until)
+	if extra <= 0 || ttl <= 0 {
+		return b.rd.Del(ctx, b.prefix+key).Err()
+	}
+	return b.rd.Set(ctx, b.prefix+key, extra, ttl).Err()
+}
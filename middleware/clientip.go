@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultClientIPHeader is the header the client address is read from
+// unless SetClientIPHeader names another.
+const DefaultClientIPHeader = "X-Forwarded-For"
+
+// No proxy is trusted until SetTrustedProxies names them, so by default
+// every request is keyed by the address it came from.
+var (
+	proxiesMu      sync.RWMutex
+	proxies        []*net.IPNet
+	clientIPHeader = DefaultClientIPHeader
+	ipv6Prefix     = 64
+)
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			// a single address, IPv4 ones in their dotted form so that the
+			// mask applies to 32 bits even when written as IPv6
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c = ip.To4().String() + "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// SetTrustedProxies replaces the proxies whose forwarding headers ClientIP
+// believes. Requests from anywhere else are keyed by their own address.
+func SetTrustedProxies(cidrs []string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+	proxies = nets
+	return nil
+}
+
+// SetClientIPHeader names the one header trusted proxies record the client
+// address in: X-Forwarded-For, Forwarded (RFC 7239) or another header
+// holding a comma separated list of addresses, oldest first.
+func SetClientIPHeader(name string) {
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+	clientIPHeader = http.CanonicalHeaderKey(name)
+}
+
+// SetIPv6Prefix sets how many leading bits of an IPv6 address KeyByIP
+// keeps, 64 by default since a single host usually holds a whole /64.
+func SetIPv6Prefix(bits int) {
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+	ipv6Prefix = bits
+}
+
+func trusted(ip net.IP) bool {
+	proxiesMu.RLock()
+	defer proxiesMu.RUnlock()
+
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of r. The client IP header is
+// only believed when r comes from a trusted proxy, and then only as far
+// back as the chain of trusted proxies goes: it is walked from the right,
+// stopping at the first untrusted address. Every other header is ignored,
+// since a client can send any of them.
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil || !trusted(remoteIP) {
+		return remote
+	}
+
+	proxiesMu.RLock()
+	header := clientIPHeader
+	proxiesMu.RUnlock()
+
+	var hops []string
+	if header == "Forwarded" {
+		hops = forwardedFor(r.Header.Values(header))
+	} else {
+		for _, v := range r.Header.Values(header) {
+			for _, hop := range strings.Split(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// unknown or obfuscated: the last proxy is as close as we get
+			break
+		}
+		client = ip.String()
+		if !trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the for= nodes of RFC 7239 Forwarded headers, in
+// order, stripped of quotes, brackets and ports.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					node = forwardedNode(kv[1])
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// forwardedNode strips a node such as "[2001:db8::17]:4711" to its address.
+func forwardedNode(node string) string {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end != -1 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// trustProxies trusts cidrs and reads the client from header for the rest
+// of the test.
+func trustProxies(t *testing.T, header string, cidrs ...string) {
+	t.Helper()
+	if err := SetTrustedProxies(cidrs); err != nil {
+		t.Fatal(err)
+	}
+	SetClientIPHeader(header)
+	t.Cleanup(func() {
+		SetTrustedProxies(nil)
+		SetClientIPHeader(DefaultClientIPHeader)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "untrusted remote",
+			remote: "203.0.113.5:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7"}},
+			want:   "203.0.113.5",
+		},
+		{
+			name:   "other headers ignored",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {"198.51.100.7"}, "Forwarded": {"for=198.51.100.8"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "remote without port",
+			remote: "203.0.113.5",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7"}},
+			want:   "203.0.113.5",
+		},
+		{
+			name:   "client behind one proxy",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7"}},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "client behind a chain of proxies",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7, 10.0.0.3 ,10.0.0.2"}},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "spoofed hops left of the first untrusted one",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.9, 192.0.2.1, 198.51.100.7, 10.0.0.2"}},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "header sent several times",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1", "198.51.100.7"}},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "every hop trusted",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:   "10.0.0.3",
+		},
+		{
+			name:   "unparseable hop",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7, unknown, 10.0.0.2"}},
+			want:   "10.0.0.2",
+		},
+		{
+			name:   "unparseable last hop",
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7, 198.51.100.8:80"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "no header",
+			remote: "10.0.0.1:1234",
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "trusted IPv6 address",
+			remote: "[2001:db8::1]:443",
+			header: http.Header{"X-Forwarded-For": {"2001:db8:cafe::17"}},
+			want:   "2001:db8:cafe::17",
+		},
+		{
+			name:   "untrusted IPv6 neighbour",
+			remote: "[2001:db8::2]:443",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.7"}},
+			want:   "2001:db8::2",
+		},
+	}
+
+	trustProxies(t, "X-Forwarded-For", "10.0.0.0/8", "2001:db8::1")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			r.Header = tt.header
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPTrustsNoProxyByDefault(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := ClientIP(r); got != "127.0.0.1" {
+		t.Errorf("ClientIP = %q, want the remote address", got)
+	}
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		want      string
+	}{
+		{
+			name:      "address with other parameters",
+			forwarded: []string{"for=198.51.100.7;proto=https;by=10.0.0.2"},
+			want:      "198.51.100.7",
+		},
+		{
+			name:      "quoted address with port",
+			forwarded: []string{`for="198.51.100.7:4711"`},
+			want:      "198.51.100.7",
+		},
+		{
+			name:      "quoted IPv6 address with port",
+			forwarded: []string{`for="[2001:db8:cafe::17]:4711"`},
+			want:      "2001:db8:cafe::17",
+		},
+		{
+			name:      "bracketed IPv6 address",
+			forwarded: []string{`For=[2001:db8:cafe::17]`},
+			want:      "2001:db8:cafe::17",
+		},
+		{
+			name:      "chain of proxies",
+			forwarded: []string{`for=192.0.2.1, for=198.51.100.7;proto=https, for="10.0.0.2:80"`},
+			want:      "198.51.100.7",
+		},
+		{
+			name:      "header sent several times",
+			forwarded: []string{"for=192.0.2.1", "for=198.51.100.7"},
+			want:      "198.51.100.7",
+		},
+		{
+			name:      "obfuscated client",
+			forwarded: []string{"for=_hidden, for=10.0.0.2"},
+			want:      "10.0.0.2",
+		},
+		{
+			name:      "element without for",
+			forwarded: []string{"for=198.51.100.7, proto=https"},
+			want:      "10.0.0.1",
+		},
+	}
+
+	trustProxies(t, "forwarded", "10.0.0.0/8")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			r.Header = http.Header{"Forwarded": tt.forwarded, "X-Forwarded-For": {"192.0.2.9"}}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{" 10.0.0.0/8 ", "10.0.0.0/8"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::/32", "2001:db8::/32"},
+	}
+	for _, tt := range tests {
+		nets, err := parseCIDRs([]string{tt.in})
+		if err != nil {
+			t.Errorf("parseCIDRs(%q): %v", tt.in, err)
+			continue
+		}
+		if len(nets) != 1 || nets[0].String() != tt.want {
+			t.Errorf("parseCIDRs(%q) = %v, want %s", tt.in, nets, tt.want)
+		}
+	}
+
+	if nets, err := parseCIDRs([]string{"", " "}); err != nil || len(nets) != 0 {
+		t.Errorf("blank entries gave %v, %v, want none", nets, err)
+	}
+	for _, in := range []string{"proxy.internal", "10.0.0.0/33"} {
+		if _, err := parseCIDRs([]string{in}); err == nil {
+			t.Errorf("parseCIDRs(%q) did not fail", in)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-redis/redis/v8"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Semaphore counts the requests in flight for each key.
+type Semaphore interface {
+	// TryAcquire takes one of the limit slots of key if any is free. The
+	// token it returns releases the slot.
+	TryAcquire(ctx context.Context, key string, limit int) (token string, ok bool, err error)
+	Release(ctx context.Context, key, token string) error
+}
+
+type ConcurrencyOption func(cl *concurrencyLimiter)
+
+// WithSemaphore replaces the default in-memory semaphore, whose slots are
+// only shared by the requests of one dyno.
+func WithSemaphore(s Semaphore) ConcurrencyOption {
+	return func(cl *concurrencyLimiter) {
+		cl.semaphore = s
+	}
+}
+
+// WithQueueTimeout sets how long a request waits for a slot before it is
+// refused. Without it requests are refused as soon as every slot is taken.
+func WithQueueTimeout(d time.Duration) ConcurrencyOption {
+	return func(cl *concurrencyLimiter) {
+		cl.queueTimeout = d
+	}
+}
+
+// WithConcurrencyKeyFuncs sets what requests share slots, by account unless
+// set.
+func WithConcurrencyKeyFuncs(keyFuncs ...KeyFunc) ConcurrencyOption {
+	return func(cl *concurrencyLimiter) {
+		if len(keyFuncs) > 0 {
+			cl.keyFn = composedKeyFunc(keyFuncs...)
+		}
+	}
+}
+
+// WithBusyStatus sets the status of refused requests:
+// http.StatusTooManyRequests, the default, blames the client for having
+// too much in flight; http.StatusServiceUnavailable blames the server.
+func WithBusyStatus(status int) ConcurrencyOption {
+	return func(cl *concurrencyLimiter) {
+		cl.busyStatus = status
+	}
+}
+
+type concurrencyLimiter struct {
+	limit        int
+	semaphore    Semaphore
+	queueTimeout time.Duration
+	keyFn        KeyFunc
+	busyStatus   int
+}
+
+// LimitConcurrency caps the requests each account has in flight at once,
+// so that one account's slow requests cannot hold every connection of the
+// shared database pool. Requests over the cap wait up to the queue timeout
+// for a slot, then are refused with a Retry-After. Where Limit caps how
+// often requests arrive, LimitConcurrency caps how many are served at once.
+func LimitConcurrency(limit int, options ...ConcurrencyOption) func(next http.Handler) http.Handler {
+	cl := &concurrencyLimiter{
+		limit:      limit,
+		keyFn:      KeyByAccount,
+		busyStatus: http.StatusTooManyRequests,
+	}
+	for _, opt := range options {
+		opt(cl)
+	}
+	if cl.semaphore == nil {
+		cl.semaphore = newLocalSemaphore()
+	}
+	return cl.Handler
+}
+
+func (cl *concurrencyLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cl.limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := cl.keyFn(r)
+		if err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusPreconditionRequired, err))
+			return
+		}
+
+		token, ok, err := cl.acquire(r.Context(), key)
+		if err != nil {
+			pkg.Logger(r.Context()).WithError(err).Error("concurrency limit: semaphore failed")
+			pkg.Render(w, r, errors.Wrap(err, "concurrency limit"))
+			return
+		}
+		if !ok {
+			pkg.Logger(r.Context()).WithField("in_flight", cl.limit).Warn("concurrency limit: no slot free")
+			w.Header().Set("Retry-After", "1")
+			pkg.Render(w, r, pkg.WithStatus(cl.busyStatus,
+				errors.Errorf("too many requests in flight, at most %d at once", cl.limit)))
+			return
+		}
+		defer func() {
+			if err := cl.semaphore.Release(pkg.Detach(r.Context()), key, token); err != nil {
+				pkg.Logger(r.Context()).WithError(err).Error("concurrency limit: release failed")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire waits for a slot of key until the queue timeout, polling with a
+// growing interval so queued requests do not flood the semaphore.
+func (cl *concurrencyLimiter) acquire(ctx context.Context, key string) (string, bool, error) {
+	deadline := time.Now().Add(cl.queueTimeout)
+	wait := 5 * time.Millisecond
+	for {
+		token, ok, err := cl.semaphore.TryAcquire(ctx, key, cl.limit)
+		if err != nil || ok {
+			return token, ok, err
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return "", false, nil
+		}
+		if wait > left {
+			wait = left
+		}
+		select {
+		case <-ctx.Done():
+			return "", false, nil
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+	}
+}
+
+type localSemaphore struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func newLocalSemaphore() *localSemaphore {
+	return &localSemaphore{inFlight: map[string]int{}}
+}
+
+func (s *localSemaphore) TryAcquire(ctx context.Context, key string, limit int) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight[key] >= limit {
+		return "", false, nil
+	}
+	s.inFlight[key]++
+	return "", true, nil
+}
+
+func (s *localSemaphore) Release(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight[key]--; s.inFlight[key] <= 0 {
+		delete(s.inFlight, key)
+	}
+	return nil
+}
+
+// acquireScript drops the expired slots of KEYS[1], a sorted set of tokens
+// scored by when their lease ends, then adds ARGV[4] if fewer than ARGV[2]
+// are left.
+//
+// ARGV: now (ms), limit, lease end (ms), token, lease (ms)
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+type redisSemaphore struct {
+	rd     *redis.Client
+	prefix string
+	lease  time.Duration
+}
+
+var _ Semaphore = redisSemaphore{}
+
+// NewRedisSemaphore shares slots between dynos through redis. A slot is
+// leased: if its dyno dies before releasing it, it frees itself once lease
+// has passed, so lease must outlast the longest request.
+func NewRedisSemaphore(rd *redis.Client, prefix string, lease time.Duration) Semaphore {
+	return redisSemaphore{rd: rd, prefix: prefix, lease: lease}
+}
+
+func (s redisSemaphore) TryAcquire(ctx context.Context, key string, limit int) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(b)
+
+	now := time.Now()
+	ok, err := acquireScript.Run(ctx, s.rd, []string{s.prefix + key},
+		now.UnixNano()/1e6, limit, now.Add(s.lease).UnixNano()/1e6, token, s.lease.Milliseconds()).Int()
+	if err != nil {
+		return "", false, err
+	}
+	return token, ok == 1, nil
+}
+
+func (s redisSemaphore) Release(ctx context.Context, key, token string) error {
+	return s.rd.ZRem(ctx, s.prefix+key, token).Err()
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GCRA is the generic cell rate algorithm. A limit of n per window lets a
+// request through every window/n, and up to burst of them at once after a
+// quiet spell. Unlike the sliding window, it never lets a whole window's
+// quota through at a window boundary. Its state is kept in memory.
+func GCRA(burst int) Algorithm {
+	return &gcra{burst: burst, tats: map[string]time.Time{}}
+}
+
+// gcraTake returns the state of t for a request at now, given the
+// theoretical arrival time of the key, and the arrival time to store if
+// the request is let through.
+func gcraTake(now, tat time.Time, t Take, burst int) (State, time.Time) {
+	interval, tolerance := gcraParams(t, burst)
+
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+
+	if wait := next.Sub(now) - tolerance; wait > 0 {
+		return State{Limit: t.Limit, Reset: tat, RetryAfter: wait}, tat
+	}
+	remaining := int((tolerance - next.Sub(now)) / interval)
+	return State{Limit: t.Limit, Remaining: remaining, Reset: next}, next
+}
+
+// gcraParams returns how far apart requests of t are spaced and how far
+// ahead of now its arrival time may run.
+func gcraParams(t Take, burst int) (time.Duration, time.Duration) {
+	interval := t.Length / time.Duration(t.Limit)
+	if burst < 1 {
+		burst = 1
+	}
+	if burst > t.Limit {
+		burst = t.Limit
+	}
+	return interval, interval * time.Duration(burst)
+}
+
+// gcraPeek returns the state of t at now without a request.
+func gcraPeek(now, tat time.Time, t Take, burst int) State {
+	interval, tolerance := gcraParams(t, burst)
+
+	if tat.Before(now) {
+		tat = now
+	}
+	if wait := tat.Add(interval).Sub(now) - tolerance; wait > 0 {
+		return State{Limit: t.Limit, Reset: tat, RetryAfter: wait}
+	}
+	return State{Limit: t.Limit, Remaining: int((tolerance - tat.Sub(now)) / interval), Reset: tat}
+}
+
+func gcraKey(t Take) string {
+	return t.Key + "/" + t.Length.String()
+}
+
+type gcra struct {
+	burst int
+
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastEvict time.Time
+}
+
+func (a *gcra) Take(ctx context.Context, now time.Time, takes []Take) ([]State, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.evict(now)
+
+	states := make([]State, len(takes))
+	next := make([]time.Time, len(takes))
+	ok := true
+	for i, t := range takes {
+		states[i], next[i] = gcraTake(now, a.tats[gcraKey(t)], t, a.burst)
+		if states[i].RetryAfter > 0 {
+			ok = false
+		}
+	}
+	if !ok {
+		return states, false, nil
+	}
+
+	for i, t := range takes {
+		a.tats[gcraKey(t)] = next[i]
+	}
+	return states, true, nil
+}
+
+func (a *gcra) Peek(ctx context.Context, now time.Time, takes []Take) ([]State, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	states := make([]State, len(takes))
+	for i, t := range takes {
+		states[i] = gcraPeek(now, a.tats[gcraKey(t)], t, a.burst)
+	}
+	return states, nil
+}
+
+func (a *gcra) Reset(ctx context.Context, now time.Time, takes []Take) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, t := range takes {
+		delete(a.tats, gcraKey(t))
+	}
+	return nil
+}
+
+// evict drops the keys that have fully recovered, once a minute.
+func (a *gcra) evict(now time.Time) {
+	if now.Sub(a.lastEvict) < time.Minute {
+		return
+	}
+	a.lastEvict = now
+
+	for k, tat := range a.tats {
+		if tat.Before(now) {
+			delete(a.tats, k)
+		}
+	}
+}
+
+// gcraScript stores the theoretical arrival times of several keys when
+// none of them is beyond its tolerance, in one step. Times are in
+// microseconds. KEYS holds the key of each take, ARGV now followed by the
+// interval and tolerance of each. It returns whether the request was let
+// through followed by the arrival time each key had.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local ok = 1
+local result = {0}
+local next = {}
+for i = 1, #KEYS do
+	local interval = tonumber(ARGV[2*i])
+	local tolerance = tonumber(ARGV[2*i+1])
+	local tat = tonumber(redis.call('GET', KEYS[i]) or '0')
+	if tat < now then
+		tat = now
+	end
+	next[i] = tat + interval
+	if next[i] - now > tolerance then
+		ok = 0
+	end
+	result[i+1] = tat
+end
+if ok == 1 then
+	for i = 1, #KEYS do
+		redis.call('SET', KEYS[i], string.format('%.0f', next[i]), 'PX', math.ceil((next[i] - now) / 1000))
+	end
+end
+result[1] = ok
+return result
+`)
+
+type redisGCRA struct {
+	rd     *redis.Client
+	prefix string
+	burst  int
+}
+
+// RedisGCRA is GCRA keeping its state in redis under prefix, so that every
+// instance of the app shares it.
+func RedisGCRA(rd *redis.Client, prefix string, burst int) Algorithm {
+	return &redisGCRA{rd: rd, prefix: prefix, burst: burst}
+}
+
+func (a *redisGCRA) Take(ctx context.Context, now time.Time, takes []Take) ([]State, bool, error) {
+	keys := make([]string, len(takes))
+	args := []interface{}{now.UnixNano() / 1e3}
+	for i, t := range takes {
+		keys[i] = a.prefix + gcraKey(t)
+		interval, tolerance := gcraParams(t, a.burst)
+		args = append(args, interval.Microseconds(), tolerance.Microseconds())
+	}
+
+	res, err := gcraScript.Run(ctx, a.rd, keys, args...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	values, _ := res.([]interface{})
+	if len(values) != len(takes)+1 {
+		return nil, false, errors.Errorf("unexpected reply from gcra script: %v", res)
+	}
+	states := make([]State, len(takes))
+	for i, t := range takes {
+		us, _ := values[i+1].(int64)
+		states[i], _ = gcraTake(now, time.Unix(0, us*1e3).UTC(), t, a.burst)
+	}
+	ok, _ := values[0].(int64)
+	return states, ok == 1, nil
+}
+
+func (a *redisGCRA) Peek(ctx context.Context, now time.Time, takes []Take) ([]State, error) {
+	keys := make([]string, len(takes))
+	for i, t := range takes {
+		keys[i] = a.prefix + gcraKey(t)
+	}
+	values, err := a.rd.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, len(takes))
+	for i, t := range takes {
+		var tat time.Time
+		if s, ok := values[i].(string); ok {
+			us, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			tat = time.Unix(0, us*1e3).UTC()
+		}
+		states[i] = gcraPeek(now, tat, t, a.burst)
+	}
+	return states, nil
+}
+
+func (a *redisGCRA) Reset(ctx context.Context, now time.Time, takes []Take) error {
+	keys := make([]string, len(takes))
+	for i, t := range takes {
+		keys[i] = a.prefix + gcraKey(t)
+	}
+	return a.rd.Del(ctx, keys...).Err()
+}
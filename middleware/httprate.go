@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"github.com/cespare/xxhash/v2"
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
 	"math"
 	"net"
 	"net/http"
@@ -19,6 +21,15 @@ func Limit(requestLimit int, windowLength time.Duration, options ...Option) func
 type KeyFunc func(r *http.Request) (string, error)
 type Option func(rl *rateLimiter)
 
+// ErrNoKey is wrapped by the errors of key functions for requests that lack
+// what they are limited by, such as an account. Those requests are refused
+// with 428; any other error is the limiter's own, see WithFailOpen.
+var ErrNoKey = errors.New("nothing to limit the request by")
+
+// LimitFunc returns the limit for requests with key, when it varies from
+// key to key. A limit of 0 or less means there is none.
+type LimitFunc func(r *http.Request, key string) (int, error)
+
 func LimitAll(requestLimit int, windowLength time.Duration) func(next http.Handler) http.Handler {
 	return Limit(requestLimit, windowLength)
 }
@@ -27,28 +38,13 @@ func LimitByIP(requestLimit int, windowLength time.Duration) func(next http.Hand
 	return Limit(requestLimit, windowLength, WithKeyFuncs(KeyByIP))
 }
 
+// KeyByIP keys requests by ClientIP, IPv6 addresses by their prefix.
 func KeyByIP(r *http.Request) (string, error) {
-	var ip string
-
-	if tcip := r.Header.Get("True-Client-IP"); tcip != "" {
-		ip = tcip
-	} else if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		ip = xrip
-	} else if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		i := strings.Index(xff, ", ")
-		if i == -1 {
-			i = len(xff)
-		}
-		ip = xff[:i]
-	} else {
-		var err error
-		ip, _, err = net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			ip = r.RemoteAddr
-		}
-	}
+	proxiesMu.RLock()
+	bits := ipv6Prefix
+	proxiesMu.RUnlock()
 
-	return canonicalizeIP(ip), nil
+	return canonicalizeIP(ClientIP(r), bits), nil
 }
 
 func KeyByEndpoint(r *http.Request) (string, error) {
@@ -56,8 +52,7 @@ func KeyByEndpoint(r *http.Request) (string, error) {
 }
 
 func KeyByFrom(r *http.Request) (string, error) {
-	pkg.DecodePostRequest()
-	return pkg.GetDecodedPostRequest().From, nil
+	return pkg.GetDecodedPostRequest(r.Context()).From, nil
 }
 
 func WithKeyFuncs(keyFuncs ...KeyFunc) Option {
@@ -74,6 +69,31 @@ func WithLimitHandler(h http.HandlerFunc) Option {
 	}
 }
 
+// WithLimitFunc replaces the fixed request limit with one looked up for
+// every request.
+func WithLimitFunc(fn LimitFunc) Option {
+	return func(rl *rateLimiter) {
+		rl.limitFn = fn
+	}
+}
+
+// WithAlgorithm replaces the default sliding window, counted with the
+// limiter's LimitCounter, with a.
+func WithAlgorithm(a Algorithm) Option {
+	return func(rl *rateLimiter) {
+		rl.algorithm = a
+	}
+}
+
+// WithFailOpen lets requests through when the limits cannot be checked,
+// such as while redis is down, instead of refusing them with 503. Requests
+// without a key are refused either way.
+func WithFailOpen(failOpen bool) Option {
+	return func(rl *rateLimiter) {
+		rl.failOpen = failOpen
+	}
+}
+
 func WithLimitCounter(c LimitCounter) Option {
 	return func(rl *rateLimiter) {
 		rl.limitCounter = c
@@ -96,8 +116,8 @@ func composedKeyFunc(keyFuncs ...KeyFunc) KeyFunc {
 
 // canonicalizeIP returns a form of ip suitable for comparison to other IPs.
 // For IPv4 addresses, this is simply the whole string.
-// For IPv6 addresses, this is the /64 prefix.
-func canonicalizeIP(ip string) string {
+// For IPv6 addresses, this is the prefix of the given bits.
+func canonicalizeIP(ip string, bits int) string {
 	isIPv6 := false
 	// This is how net.ParseIP decides if an address is IPv6
 	// https://cs.opensource.google/go/go/+/refs/tags/go1.17.7:src/net/ip.go;l=704
@@ -122,12 +142,19 @@ func canonicalizeIP(ip string) string {
 		return ip
 	}
 
-	return ipv6.Mask(net.CIDRMask(64, 128)).String()
+	return ipv6.Mask(net.CIDRMask(bits, 128)).String()
 }
 
 type LimitCounter interface {
-	Increment(key string, currentWindow time.Time) error
-	Get(key string, currentWindow, previousWindow time.Time) (int, int, error)
+	Increment(ctx context.Context, key string, currentWindow time.Time) error
+	Get(ctx context.Context, key string, currentWindow, previousWindow time.Time) (int, int, error)
+}
+
+// ResetCounter is a LimitCounter whose counts can be forgotten, as the
+// admin API does for a customer who hit a limit by mistake.
+type ResetCounter interface {
+	LimitCounter
+	Reset(ctx context.Context, key string, windows ...time.Time) error
 }
 
 func NewRateLimiter(requestLimit int, windowLength time.Duration, options ...Option) *rateLimiter {
@@ -136,6 +163,7 @@ func NewRateLimiter(requestLimit int, windowLength time.Duration, options ...Opt
 
 func newRateLimiter(requestLimit int, windowLength time.Duration, options ...Option) *rateLimiter {
 	rl := &rateLimiter{
+		name:         "default",
 		requestLimit: requestLimit,
 		windowLength: windowLength,
 	}
@@ -151,15 +179,16 @@ func newRateLimiter(requestLimit int, windowLength time.Duration, options ...Opt
 	}
 
 	if rl.limitCounter == nil {
-		rl.limitCounter = &localCounter{
-			counters:     make(map[uint64]*count),
-			windowLength: windowLength,
-		}
+		rl.limitCounter = newLocalCounter(windowLength)
+	}
+
+	if rl.algorithm == nil {
+		rl.algorithm = SlidingWindow(rl.limitCounter)
 	}
 
 	if rl.onRequestLimit == nil {
 		rl.onRequestLimit = func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			pkg.Render(w, r, pkg.WithStatus(http.StatusTooManyRequests, errors.New("rate limit exceeded")))
 		}
 	}
 
@@ -174,70 +203,194 @@ func LimitCounterKey(key string, window time.Time) uint64 {
 }
 
 type rateLimiter struct {
+	// name names the limit in the RateLimit headers
+	name           string
 	requestLimit   int
 	windowLength   time.Duration
 	keyFn          KeyFunc
+	limitFn        LimitFunc
 	limitCounter   LimitCounter
+	algorithm      Algorithm
+	boosts         Boosts
 	onRequestLimit http.HandlerFunc
+	failOpen       bool
 }
 
 func (r *rateLimiter) Counter() LimitCounter {
 	return r.limitCounter
 }
 
-func (r *rateLimiter) Status(key string) (bool, float64, error) {
+func (r *rateLimiter) Status(ctx context.Context, key string) (bool, float64, error) {
+	return r.status(ctx, key, r.requestLimit)
+}
+
+func (r *rateLimiter) status(ctx context.Context, key string, limit int) (bool, float64, error) {
 	t := time.Now().UTC()
 	currentWindow := t.Truncate(r.windowLength)
 	previousWindow := currentWindow.Add(-r.windowLength)
 
-	currCount, prevCount, err := r.limitCounter.Get(key, currentWindow, previousWindow)
+	currCount, prevCount, err := r.limitCounter.Get(ctx, key, currentWindow, previousWindow)
 	if err != nil {
 		return false, 0, err
 	}
 
-	diff := t.Sub(currentWindow)
-	rate := float64(prevCount)*(float64(r.windowLength)-float64(diff))/float64(r.windowLength) + float64(currCount)
+	rate := slidingRate(currCount, prevCount, prevWeight(t, r.windowLength))
 
-	if rate > float64(r.requestLimit) {
+	if rate > float64(limit) {
 		return false, rate, nil
 	}
 	return true, rate, nil
 }
 
-func (l *rateLimiter) Handler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key, err := l.keyFn(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusPreconditionRequired)
-			return
+// check is a request's take of one limiter.
+type check struct {
+	key   string
+	limit int
+	boost int
+	state State
+}
+
+func (c check) unlimited() bool {
+	return c.limit <= 0
+}
+
+// prepare returns the key and limit of r.
+func (l *rateLimiter) prepare(r *http.Request) (check, error) {
+	key, err := l.keyFn(r)
+	if err != nil {
+		return check{}, err
+	}
+
+	limit := l.requestLimit
+	if l.limitFn != nil {
+		if limit, err = l.limitFn(r, key); err != nil {
+			return check{}, err
 		}
+	}
+	return check{key: key, limit: limit}, nil
+}
+
+// Allow reports whether r is within the limit and, if it is, counts it.
+// It is the check Handler performs, for callers that send several messages
+// from a single request.
+func (l *rateLimiter) Allow(r *http.Request) (bool, error) {
+	_, _, ok, err := take(l.algorithm, []*rateLimiter{l}, r)
+	if err != nil {
+		return checkFailed(r, l.failOpen, err)
+	}
+	return ok, nil
+}
+
+// checkFailed handles a limit check that failed with err. A request without
+// a key is the client's fault and refused with 428. Anything else is a
+// failure of the limiter, such as a plan lookup or redis, and is refused
+// with 503 or, when failOpen, let through.
+func checkFailed(r *http.Request, failOpen bool, err error) (bool, error) {
+	if errors.Is(err, ErrNoKey) {
+		return false, pkg.WithStatus(http.StatusPreconditionRequired, err)
+	}
+	if failOpen {
+		pkg.Logger(r.Context()).WithError(err).Error("rate limit: check failed, letting the request through")
+		return true, nil
+	}
+	pkg.Logger(r.Context()).WithError(err).Error("rate limit: check failed")
+	return false, pkg.WithStatus(http.StatusServiceUnavailable, errors.New("rate limits are unavailable, try again later"))
+}
 
-		currentWindow := time.Now().UTC().Truncate(l.windowLength)
+func (l *rateLimiter) Handler(next http.Handler) http.Handler {
+	return handle(l.algorithm, []*rateLimiter{l}, l.onRequestLimit, l.failOpen, next)
+}
 
-		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", l.requestLimit))
-		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", 0))
-		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", currentWindow.Add(l.windowLength).Unix()))
+// take checks r against each of limiters with alg and counts it against
+// all of them if all allow it. It returns the index of the check to report:
+// the one r waits longest for when it is limited, else the one with the
+// fewest requests remaining, or -1 when no limiter limits r.
+func take(alg Algorithm, limiters []*rateLimiter, r *http.Request) ([]check, int, bool, error) {
+	checks, takes, limited, err := prepareAll(limiters, r)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if len(takes) == 0 {
+		return checks, -1, true, nil
+	}
 
-		_, rate, err := l.Status(key)
+	states, ok, err := alg.Take(r.Context(), time.Now().UTC(), takes)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	report := -1
+	for j, i := range limited {
+		checks[i].state = states[j]
+		switch {
+		case report == -1:
+			report = i
+		case !ok && states[j].RetryAfter > checks[report].state.RetryAfter:
+			report = i
+		case ok && states[j].Remaining < checks[report].state.Remaining:
+			report = i
+		}
+	}
+	return checks, report, ok, nil
+}
+
+// prepareAll prepares r for each of limiters, adding their boosts. It
+// returns the takes of the limiters that limit r, with their indexes.
+func prepareAll(limiters []*rateLimiter, r *http.Request) ([]check, []Take, []int, error) {
+	checks := make([]check, len(limiters))
+	var takes []Take
+	var limited []int
+	for i, l := range limiters {
+		c, err := l.prepare(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusPreconditionRequired)
-			return
+			return nil, nil, nil, err
+		}
+		checks[i] = c
+		if !c.unlimited() {
+			limited = append(limited, i)
 		}
-		nrate := int(math.Round(rate))
+	}
 
-		if l.requestLimit > nrate {
-			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", l.requestLimit-nrate))
+	// limiters of a policy share their boosts
+	if len(limited) > 0 && limiters[0].boosts != nil {
+		keys := make([]string, len(limited))
+		for j, i := range limited {
+			keys[j] = checks[i].key
+		}
+		extra, err := limiters[0].boosts.Extra(r.Context(), keys)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for j, i := range limited {
+			checks[i].boost = extra[j]
+			checks[i].limit += extra[j]
 		}
+	}
+
+	for _, i := range limited {
+		takes = append(takes, Take{Key: checks[i].key, Limit: checks[i].limit, Length: limiters[i].windowLength})
+	}
+	return checks, takes, limited, nil
+}
 
-		if nrate >= l.requestLimit {
-			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(l.windowLength.Seconds()))) // RFC 6585
-			l.onRequestLimit(w, r)
+func handle(alg Algorithm, limiters []*rateLimiter, onRequestLimit http.HandlerFunc, failOpen bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks, i, ok, err := take(alg, limiters, r)
+		if err != nil {
+			if ok, err := checkFailed(r, failOpen, err); !ok {
+				pkg.Render(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		err = l.limitCounter.Increment(key, currentWindow)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if i != -1 {
+			setHeaders(w, limiters, checks, i)
+		}
+		if !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", checks[i].state.retryAfterSeconds())) // RFC 6585
+			onRequestLimit(w, r)
 			return
 		}
 
@@ -245,6 +398,60 @@ func (l *rateLimiter) Handler(next http.Handler) http.Handler {
 	})
 }
 
+// setHeaders reports checks[i] in the X-RateLimit headers and, following
+// the IETF RateLimit header fields draft, every limit applying to the
+// request in RateLimit-Policy and checks[i] again in RateLimit.
+func setHeaders(w http.ResponseWriter, limiters []*rateLimiter, checks []check, i int) {
+	s := checks[i].state
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", s.Limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", s.Remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", s.Reset.Unix()))
+
+	var policies []string
+	for j, c := range checks {
+		if c.unlimited() {
+			continue
+		}
+		policies = append(policies, fmt.Sprintf("%q;q=%d;w=%d", limiters[j].name, c.limit, int(limiters[j].windowLength.Seconds())))
+	}
+	w.Header().Set("RateLimit-Policy", strings.Join(policies, ", "))
+
+	reset := int(math.Ceil(time.Until(s.Reset).Seconds()))
+	if reset < 0 {
+		reset = 0
+	}
+	w.Header().Set("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", limiters[i].name, s.Remaining, reset))
+}
+
+// prevWeight is the share of the previous window still inside the sliding
+// window of length at t.
+func prevWeight(t time.Time, length time.Duration) float64 {
+	diff := t.Sub(t.Truncate(length))
+	return (float64(length) - float64(diff)) / float64(length)
+}
+
+// slidingRate estimates the requests in the sliding window from the counts
+// of the current and previous fixed windows.
+func slidingRate(curr, prev int, weight float64) float64 {
+	return float64(prev)*weight + float64(curr)
+}
+
+// Count adds one to key in c for the window of length at now, and returns
+// the count of the sliding window ending at now as the limiters estimate
+// it. It lets other checks keep counts the way the limiters do.
+func Count(ctx context.Context, c LimitCounter, key string, length time.Duration, now time.Time) (float64, error) {
+	now = now.UTC()
+	currentWindow := now.Truncate(length)
+	if err := c.Increment(ctx, key, currentWindow); err != nil {
+		return 0, err
+	}
+	curr, prev, err := c.Get(ctx, key, currentWindow, currentWindow.Add(-length))
+	if err != nil {
+		return 0, err
+	}
+	return slidingRate(curr, prev, prevWeight(now, length)), nil
+}
+
 type localCounter struct {
 	counters     map[uint64]*count
 	windowLength time.Duration
@@ -252,19 +459,34 @@ type localCounter struct {
 	mu           sync.Mutex
 }
 
-var _ LimitCounter = &localCounter{}
+var (
+	_ MultiCounter = &localCounter{}
+	_ ResetCounter = &localCounter{}
+)
+
+func newLocalCounter(windowLength time.Duration) *localCounter {
+	return &localCounter{
+		counters:     make(map[uint64]*count),
+		windowLength: windowLength,
+	}
+}
 
 type count struct {
 	value     int
 	updatedAt time.Time
 }
 
-func (c *localCounter) Increment(key string, currentWindow time.Time) error {
+func (c *localCounter) Increment(ctx context.Context, key string, currentWindow time.Time) error {
 	c.evict()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.increment(key, currentWindow)
+	return nil
+}
+
+func (c *localCounter) increment(key string, currentWindow time.Time) {
 	hkey := LimitCounterKey(key, currentWindow)
 
 	v, ok := c.counters[hkey]
@@ -274,14 +496,17 @@ func (c *localCounter) Increment(key string, currentWindow time.Time) error {
 	}
 	v.value += 1
 	v.updatedAt = time.Now()
-
-	return nil
 }
 
-func (c *localCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+func (c *localCounter) Get(ctx context.Context, key string, currentWindow, previousWindow time.Time) (int, int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	curr, prev := c.get(key, currentWindow, previousWindow)
+	return curr, prev, nil
+}
+
+func (c *localCounter) get(key string, currentWindow, previousWindow time.Time) (int, int) {
 	curr, ok := c.counters[LimitCounterKey(key, currentWindow)]
 	if !ok {
 		curr = &count{value: 0, updatedAt: time.Now()}
@@ -291,7 +516,42 @@ func (c *localCounter) Get(key string, currentWindow, previousWindow time.Time)
 		prev = &count{value: 0, updatedAt: time.Now()}
 	}
 
-	return curr.value, prev.value, nil
+	return curr.value, prev.value
+}
+
+func (c *localCounter) Reset(ctx context.Context, key string, windows ...time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, w := range windows {
+		delete(c.counters, LimitCounterKey(key, w))
+	}
+	return nil
+}
+
+func (c *localCounter) TakeAll(ctx context.Context, now time.Time, takes []Take) ([]Counts, bool, error) {
+	c.evict()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]Counts, len(takes))
+	ok := true
+	for i, t := range takes {
+		currentWindow := now.Truncate(t.Length)
+		counts[i].Curr, counts[i].Prev = c.get(t.Key, currentWindow, currentWindow.Add(-t.Length))
+		if counts[i].rate(now, t.Length) >= t.Limit {
+			ok = false
+		}
+	}
+	if !ok {
+		return counts, false, nil
+	}
+
+	for _, t := range takes {
+		c.increment(t.Key, now.Truncate(t.Length))
+	}
+	return counts, true, nil
 }
 
 func (c *localCounter) evict() {
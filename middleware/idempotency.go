@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyTTL    = 24 * time.Hour
+	// idempotencyLease is how long a key stays claimed by a request that
+	// has not completed. It is renewed while the request runs, so a request
+	// that dies frees its key soon rather than after the TTL.
+	idempotencyLease = 30 * time.Second
+	// maxIdempotentBodyBytes bounds the bodies read for fingerprinting. It
+	// is the largest body the API takes, a contacts CSV import.
+	maxIdempotentBodyBytes = 5 << 20
+)
+
+// IdempotentRecord is what is kept for an Idempotency-Key: the fingerprint
+// of the request that claimed it and, once it completed, its response.
+type IdempotentRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps IdempotentRecords for a limited time.
+type IdempotencyStore interface {
+	// Begin claims key for a request with the given fingerprint for lease.
+	// It returns nil when the claim succeeded, or the record already held
+	// for key.
+	Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*IdempotentRecord, error)
+	// Extend renews a claim for another lease, as long as it is still held
+	// by the request with fingerprint.
+	Extend(ctx context.Context, key, fingerprint string, lease time.Duration) error
+	// Complete replaces a claim with the response, kept for ttl.
+	Complete(ctx context.Context, key string, rec IdempotentRecord, ttl time.Duration) error
+	// Release drops a claim still held by the request with fingerprint so
+	// the request can be retried.
+	Release(ctx context.Context, key, fingerprint string) error
+}
+
+// Idempotency honours the Idempotency-Key header on POST requests. The first
+// request with a key is processed and its response stored; a retry with the
+// same key and body gets the stored response back without being processed
+// again, while reusing the key for a different request is refused with 422.
+// Only successful responses and client errors that a retry would get again
+// are stored; anything else, such as a 429 or a 5xx, can be retried.
+//
+// It must run after BasicAuth, since keys are scoped per account, and before
+// Limit so replays are not counted against the rate limit.
+func Idempotency(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idemKey := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || idemKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idemKey) > maxIdempotencyKeyLength {
+				pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest,
+					errors.Errorf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+				return
+			}
+
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil && len(body) >= maxIdempotentBodyBytes {
+				pkg.Render(w, r, pkg.WithStatus(http.StatusRequestEntityTooLarge,
+					errors.Errorf("request body must be at most %d bytes", maxIdempotentBodyBytes)))
+				return
+			}
+			if err != nil {
+				pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, err))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			key := fmt.Sprintf("%d:%s", pkg.AccountID(r.Context()), idemKey)
+			fingerprint := requestFingerprint(r, body)
+
+			rec, err := store.Begin(r.Context(), key, fingerprint, idempotencyLease)
+			if err != nil {
+				pkg.Render(w, r, err)
+				return
+			}
+			if rec != nil {
+				switch {
+				case rec.Fingerprint != fingerprint:
+					pkg.Render(w, r, pkg.WithStatus(http.StatusUnprocessableEntity,
+						errors.Errorf("%s was already used for a different request", IdempotencyKeyHeader)))
+				case !rec.Done:
+					pkg.Render(w, r, pkg.WithStatus(http.StatusConflict,
+						errors.Errorf("a request with this %s is still being processed", IdempotencyKeyHeader)))
+				default:
+					replay(w, rec)
+				}
+				return
+			}
+
+			stop := keepClaim(r, store, key, fingerprint)
+			rw := &responseRecorder{ResponseWriter: w}
+			completed := false
+			defer func() {
+				stop()
+				if completed {
+					return
+				}
+				if err := store.Release(pkg.Detach(r.Context()), key, fingerprint); err != nil {
+					pkg.Logger(r.Context()).WithError(err).Error("unable to release idempotency key")
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if !replayable(status) {
+				return
+			}
+
+			stop()
+
+			err = store.Complete(pkg.Detach(r.Context()), key, IdempotentRecord{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      status,
+				Header:      rw.Header().Clone(),
+				Body:        rw.body.Bytes(),
+			}, ttl)
+			if err != nil {
+				pkg.Logger(r.Context()).WithError(err).Error("unable to store idempotent response")
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// keepClaim renews the claim on key until the returned func is called,
+// which waits for any renewal in progress so it cannot outlive the claim.
+func keepClaim(r *http.Request, store IdempotencyStore, key, fingerprint string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := store.Extend(r.Context(), key, fingerprint, idempotencyLease); err != nil {
+					pkg.Logger(r.Context()).WithError(err).Warn("unable to extend idempotency key")
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// replayable reports whether a response with status is stored for replay:
+// a success, or a client error that does not depend on timing or load.
+func replayable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusLocked,
+		http.StatusTooEarly, http.StatusPreconditionRequired, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= http.StatusOK && status < http.StatusMultipleChoices ||
+		status >= http.StatusBadRequest && status < http.StatusInternalServerError
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *IdempotentRecord) {
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// responseRecorder keeps a copy of the response while writing it through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+type redisIdempotencyStore struct {
+	rd     *redis.Client
+	prefix string
+}
+
+var _ IdempotencyStore = &redisIdempotencyStore{}
+
+// NewRedisIdempotencyStore keeps idempotency records in redis under prefix.
+func NewRedisIdempotencyStore(rd *redis.Client, prefix string) IdempotencyStore {
+	return &redisIdempotencyStore{rd: rd, prefix: prefix}
+}
+
+// extendClaimScript and releaseClaimScript renew and drop a claim only if
+// it is still the one given, so neither touches a stored response or the
+// claim of a later request.
+//
+// ARGV: claim, lease (ms)
+var extendClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`)
+
+// ARGV: claim
+var releaseClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+func encodeClaim(fingerprint string) ([]byte, error) {
+	return json.Marshal(IdempotentRecord{Fingerprint: fingerprint})
+}
+
+func (s *redisIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*IdempotentRecord, error) {
+	claim, err := encodeClaim(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.rd.SetNX(ctx, s.prefix+key, claim, lease).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+
+	raw, err := s.rd.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		// expired or released between SETNX and GET, try again
+		return s.Begin(ctx, key, fingerprint, lease)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec IdempotentRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *redisIdempotencyStore) Extend(ctx context.Context, key, fingerprint string, lease time.Duration) error {
+	claim, err := encodeClaim(fingerprint)
+	if err != nil {
+		return err
+	}
+	return extendClaimScript.Run(ctx, s.rd, []string{s.prefix + key}, claim, lease.Milliseconds()).Err()
+}
+
+func (s *redisIdempotencyStore) Complete(ctx context.Context, key string, rec IdempotentRecord, ttl time.Duration) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.rd.Set(ctx, s.prefix+key, raw, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) Release(ctx context.Context, key, fingerprint string) error {
+	claim, err := encodeClaim(fingerprint)
+	if err != nil {
+		return err
+	}
+	return releaseClaimScript.Run(ctx, s.rd, []string{s.prefix + key}, claim).Err()
+}
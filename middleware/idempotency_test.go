@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memIdempotencyStore keeps records in memory, without expiry.
+type memIdempotencyStore struct {
+	mu   sync.Mutex
+	recs map[string]IdempotentRecord
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{recs: map[string]IdempotentRecord{}}
+}
+
+func (s *memIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*IdempotentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.recs[key]; ok {
+		return &rec, nil
+	}
+	s.recs[key] = IdempotentRecord{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) Extend(ctx context.Context, key, fingerprint string, lease time.Duration) error {
+	return nil
+}
+
+func (s *memIdempotencyStore) Complete(ctx context.Context, key string, rec IdempotentRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recs[key] = rec
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(ctx context.Context, key, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.recs[key]; ok && !rec.Done && rec.Fingerprint == fingerprint {
+		delete(s.recs, key)
+	}
+	return nil
+}
+
+// sendIdempotent posts body with the Idempotency-Key key on behalf of
+// account 1.
+func sendIdempotent(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/outbound/sms", strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	r = r.WithContext(pkg.WithAccountID(r.Context(), 1))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// countingHandler responds with status and counts its calls.
+type countingHandler struct {
+	mu     sync.Mutex
+	calls  int
+	status int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.calls++
+	status := h.status
+	h.mu.Unlock()
+
+	w.Header().Set("X-Request-Count", "1")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"message":"sent"}`))
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+	first := sendIdempotent(h, "k1", `{"to":"+15550000002"}`)
+	second := sendIdempotent(h, "k1", `{"to":"+15550000002"}`)
+
+	if next.calls != 1 {
+		t.Fatalf("handler called %d times, want once", next.calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" || second.Header().Get("X-Request-Count") != "1" {
+		t.Errorf("replay headers %v, want the stored ones marked replayed", second.Header())
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Error("first response marked replayed")
+	}
+}
+
+func TestIdempotencyRefusesReusedKey(t *testing.T) {
+	next := &countingHandler{status: http.StatusOK}
+	h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+	sendIdempotent(h, "k1", `{"to":"+15550000002"}`)
+	w := sendIdempotent(h, "k1", `{"to":"+15550000003"}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if next.calls != 1 {
+		t.Errorf("handler called %d times, want once", next.calls)
+	}
+}
+
+func TestIdempotencyConflictsWhileInFlight(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusOK)
+	})
+	h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- sendIdempotent(h, "k1", "{}") }()
+	<-started
+
+	w := sendIdempotent(h, "k1", "{}")
+	close(finish)
+	first := <-done
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("concurrent retry status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if first.Code != http.StatusOK {
+		t.Errorf("first request status %d, want %d", first.Code, http.StatusOK)
+	}
+}
+
+func TestIdempotencyReleasesUnreplayableResponses(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			next := &countingHandler{status: status}
+			h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+			if w := sendIdempotent(h, "k1", "{}"); w.Code != status {
+				t.Fatalf("status %d, want %d", w.Code, status)
+			}
+
+			// the retry is processed again, and its success kept
+			next.status = http.StatusCreated
+			if w := sendIdempotent(h, "k1", "{}"); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+				t.Fatalf("retry %d replayed=%q, want it processed", w.Code, w.Header().Get(IdempotentReplayedHeader))
+			}
+			if w := sendIdempotent(h, "k1", "{}"); w.Header().Get(IdempotentReplayedHeader) != "true" {
+				t.Error("success after the retry was not replayed")
+			}
+			if next.calls != 2 {
+				t.Errorf("handler called %d times, want 2", next.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyScopesKeysByAccount(t *testing.T) {
+	next := &countingHandler{status: http.StatusOK}
+	h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+	sendIdempotent(h, "k1", "{}")
+	r := httptest.NewRequest(http.MethodPost, "/outbound/sms", strings.NewReader("{}"))
+	r.Header.Set(IdempotencyKeyHeader, "k1")
+	r = r.WithContext(pkg.WithAccountID(r.Context(), 2))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if next.calls != 2 {
+		t.Errorf("handler called %d times, want once for each account", next.calls)
+	}
+}
+
+func TestIdempotencyIgnoresOtherRequests(t *testing.T) {
+	next := &countingHandler{status: http.StatusOK}
+	h := Idempotency(newMemIdempotencyStore(), time.Hour)(next)
+
+	for i := 0; i < 2; i++ {
+		sendIdempotent(h, "", "{}")
+		r := httptest.NewRequest(http.MethodGet, "/outbound/sms", nil)
+		r.Header.Set(IdempotencyKeyHeader, "k1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if next.calls != 4 {
+		t.Errorf("handler called %d times, want 4", next.calls)
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusCreated, true},
+		{http.StatusBadRequest, true},
+		{http.StatusForbidden, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusFound, false},
+		{http.StatusRequestTimeout, false},
+		{http.StatusConflict, false},
+		{http.StatusLocked, false},
+		{http.StatusTooEarly, false},
+		{http.StatusPreconditionRequired, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		if got := replayable(tt.status); got != tt.want {
+			t.Errorf("replayable(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"time"
+)
+
+// RequestLogger stores a structured logger in the request context and
+// writes one access log line per request. It must run after
+// middleware.RequestID and Trace so both IDs can be attached.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := logrus.Fields{
+			"request_id": chimiddleware.GetReqID(r.Context()),
+			"method":     r.Method,
+			"path":       r.URL.Path,
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+		}
+		entry := logrus.WithFields(fields)
+
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r.WithContext(pkg.WithLogger(r.Context(), entry)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			entry = entry.WithField("route", rctx.RoutePattern())
+		}
+		entry = entry.WithFields(logrus.Fields{
+			"status":     status,
+			"bytes":      ww.BytesWritten(),
+			"latency_ms": time.Since(start).Milliseconds(),
+		})
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request completed")
+		case status >= http.StatusBadRequest:
+			entry.Warn("request completed")
+		default:
+			entry.Info("request completed")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyByAccount keys requests by the account they are made for, as stored
+// by BasicAuth.
+func KeyByAccount(r *http.Request) (string, error) {
+	id := pkg.AccountID(r.Context())
+	if id == 0 {
+		return "", errors.Wrap(ErrNoKey, "no account")
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func keyPrefix(prefix string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return prefix, nil
+	}
+}
+
+// The windows of a plan limiter, by what they are keyed by.
+var (
+	SenderWindows  = []string{"sender-second", "sender-hour", "sender-day"}
+	AccountWindows = []string{"account-second", "account-hour", "account-day"}
+)
+
+// NewPlanLimiter returns a Policy limiting messages to the caps of the
+// plan of the account they are sent for: per sender and per account, over
+// a second, an hour and a day. Plans are looked up with findPlan on every
+// request, so a limit follows its plan without a redeploy.
+func NewPlanLimiter(findPlan func(context.Context, int64) (*account.Plan, error), options ...Option) *Policy {
+	capOf := func(limit func(*account.Plan) int) LimitFunc {
+		return func(r *http.Request, _ string) (int, error) {
+			p, err := findPlan(r.Context(), pkg.AccountID(r.Context()))
+			if err != nil {
+				return 0, errors.Wrap(err, "unable to find plan")
+			}
+			return limit(p), nil
+		}
+	}
+
+	bySender := []KeyFunc{KeyByAccount, keyPrefix(":"), KeyByFrom}
+	byAccount := []KeyFunc{KeyByAccount}
+	return NewPolicy([]Window{
+		{Name: "sender-second", Length: time.Second, KeyFuncs: bySender, LimitFunc: capOf(func(p *account.Plan) int { return p.SenderPerSecond })},
+		{Name: "sender-hour", Length: time.Hour, KeyFuncs: bySender, LimitFunc: capOf(func(p *account.Plan) int { return p.SenderPerHour })},
+		{Name: "sender-day", Length: 24 * time.Hour, KeyFuncs: bySender, LimitFunc: capOf(func(p *account.Plan) int { return p.SenderPerDay })},
+		{Name: "account-second", Length: time.Second, KeyFuncs: byAccount, LimitFunc: capOf(func(p *account.Plan) int { return p.AccountPerSecond })},
+		{Name: "account-hour", Length: time.Hour, KeyFuncs: byAccount, LimitFunc: capOf(func(p *account.Plan) int { return p.AccountPerHour })},
+		{Name: "account-day", Length: 24 * time.Hour, KeyFuncs: byAccount, LimitFunc: capOf(func(p *account.Plan) int { return p.AccountPerDay })},
+	}, options...)
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Take is a request's share of one window of a Policy.
+type Take struct {
+	Key    string
+	Limit  int
+	Length time.Duration
+}
+
+// Counts are the counts of a key in the current and previous window.
+type Counts struct {
+	Curr, Prev int
+}
+
+// rate is the sliding rate of c at now, rounded.
+func (c Counts) rate(now time.Time, length time.Duration) int {
+	return int(math.Round(slidingRate(c.Curr, c.Prev, prevWeight(now, length))))
+}
+
+// MultiCounter is a LimitCounter that counts a request against several
+// windows as one step, so that concurrent requests cannot overrun one
+// window while being counted in another.
+type MultiCounter interface {
+	LimitCounter
+	// TakeAll returns the counts of each take at now, before the request,
+	// and, if none of them is at its limit, counts the request against
+	// all of them.
+	TakeAll(ctx context.Context, now time.Time, takes []Take) ([]Counts, bool, error)
+}
+
+// Window is one of the limits of a Policy, such as a burst limit of 1 a
+// second next to a sustained one of 50 a day.
+type Window struct {
+	// Name names the window in the RateLimit headers.
+	Name     string
+	Limit    int
+	Length   time.Duration
+	KeyFuncs []KeyFunc
+	// LimitFunc, when set, looks the limit up for every request instead
+	// of using Limit.
+	LimitFunc LimitFunc
+}
+
+// Policy limits requests by several windows in a single check. A request
+// is counted against every window or against none, and the headers report
+// the window with the fewest requests left.
+type Policy struct {
+	windows        []*rateLimiter
+	algorithm      Algorithm
+	onRequestLimit http.HandlerFunc
+	failOpen       bool
+}
+
+// NewPolicy returns a Policy of windows. All windows share one algorithm
+// and counter, the local sliding window unless set with WithAlgorithm or
+// WithLimitCounter. WithKeyFuncs and WithLimitFunc do not apply to a
+// policy, each window has its own.
+func NewPolicy(windows []Window, options ...Option) *Policy {
+	var longest time.Duration
+	for _, w := range windows {
+		if w.Length > longest {
+			longest = w.Length
+		}
+	}
+	// resolves the shared options and defaults
+	base := newRateLimiter(0, longest, options...)
+
+	p := &Policy{algorithm: base.algorithm, onRequestLimit: base.onRequestLimit, failOpen: base.failOpen}
+	for i, w := range windows {
+		opts := append(options[:len(options):len(options)],
+			WithLimitCounter(base.limitCounter),
+			WithAlgorithm(base.algorithm),
+			// the prefix keeps windows apart in the shared counter
+			WithKeyFuncs(append([]KeyFunc{keyPrefix(fmt.Sprintf("%d/%s:", i, w.Length))}, w.KeyFuncs...)...),
+			WithLimitFunc(w.LimitFunc),
+		)
+		rl := newRateLimiter(w.Limit, w.Length, opts...)
+		if rl.name = w.Name; rl.name == "" {
+			rl.name = fmt.Sprintf("window-%d", i)
+		}
+		p.windows = append(p.windows, rl)
+	}
+	return p
+}
+
+// Allow reports whether r is within every window and, if it is, counts it
+// against each.
+func (p *Policy) Allow(r *http.Request) (bool, error) {
+	_, _, ok, err := take(p.algorithm, p.windows, r)
+	if err != nil {
+		return checkFailed(r, p.failOpen, err)
+	}
+	return ok, nil
+}
+
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return handle(p.algorithm, p.windows, p.onRequestLimit, p.failOpen, next)
+}
+
+// Usage is where a request stands in one window of a Policy.
+type Usage struct {
+	Window string `json:"window"`
+	// Limit includes Boost.
+	Limit      int       `json:"limit"`
+	Boost      int       `json:"boost"`
+	Remaining  int       `json:"remaining"`
+	Reset      time.Time `json:"reset"`
+	RetryAfter int       `json:"retry_after,omitempty"`
+}
+
+// ErrNoBoosts is returned by Boost when the policy has no Boosts.
+var ErrNoBoosts = errors.New("limit boosts are not enabled")
+
+// ErrNoWindow is returned when a policy has no window of a given name.
+var ErrNoWindow = errors.New("no such window")
+
+// ErrUnlimited is returned by Boost for a window without a limit, such as
+// one its plan leaves unlimited, where a boost would have no effect.
+var ErrUnlimited = errors.New("the window has no limit to boost")
+
+// windowsNamed returns the windows of names, or all windows without names.
+func (p *Policy) windowsNamed(names []string) ([]*rateLimiter, error) {
+	if len(names) == 0 {
+		return p.windows, nil
+	}
+
+	var windows []*rateLimiter
+	for _, name := range names {
+		found := false
+		for _, w := range p.windows {
+			if w.name == name {
+				windows = append(windows, w)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Wrap(ErrNoWindow, name)
+		}
+	}
+	return windows, nil
+}
+
+// Usage reports where r stands in the windows of names that limit it,
+// without counting it.
+func (p *Policy) Usage(r *http.Request, names ...string) ([]Usage, error) {
+	windows, err := p.windowsNamed(names)
+	if err != nil {
+		return nil, err
+	}
+	checks, takes, limited, err := prepareAll(windows, r)
+	if err != nil || len(takes) == 0 {
+		return nil, err
+	}
+
+	states, err := p.algorithm.Peek(r.Context(), time.Now().UTC(), takes)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]Usage, len(limited))
+	for j, i := range limited {
+		usage[j] = Usage{
+			Window:     windows[i].name,
+			Limit:      states[j].Limit,
+			Boost:      checks[i].boost,
+			Remaining:  states[j].Remaining,
+			Reset:      states[j].Reset,
+			RetryAfter: states[j].retryAfterSeconds(),
+		}
+	}
+	return usage, nil
+}
+
+// Reset forgets the requests counted for r in the windows of names.
+func (p *Policy) Reset(r *http.Request, names ...string) error {
+	windows, err := p.windowsNamed(names)
+	if err != nil {
+		return err
+	}
+	_, takes, _, err := prepareAll(windows, r)
+	if err != nil || len(takes) == 0 {
+		return err
+	}
+	return p.algorithm.Reset(r.Context(), time.Now().UTC(), takes)
+}
+
+// Boost adds extra to the limit of the window name for requests like r,
+// until the given time.
+func (p *Policy) Boost(r *http.Request, name string, extra int, until time.Time) error {
+	windows, err := p.windowsNamed([]string{name})
+	if err != nil {
+		return err
+	}
+	w := windows[0]
+	if w.boosts == nil {
+		return ErrNoBoosts
+	}
+
+	c, err := w.prepare(r)
+	if err != nil {
+		return err
+	}
+	if c.unlimited() && extra > 0 {
+		return errors.Wrap(ErrUnlimited, name)
+	}
+	return w.boosts.Grant(r.Context(), c.key, extra, until)
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+// takeAllScript counts a request against several windows when none of
+// them is at its limit, in one step. KEYS holds the current and previous
+// window key of each take, ARGV its previous window weight, limit and the
+// expiry of its key in milliseconds. It returns whether the request was
+// counted followed by the current and previous count of each take.
+var takeAllScript = redis.NewScript(`
+local n = #KEYS / 2
+local ok = 1
+local result = {0}
+for i = 1, n do
+	local curr = tonumber(redis.call('GET', KEYS[2*i-1]) or '0')
+	local prev = tonumber(redis.call('GET', KEYS[2*i]) or '0')
+	local rate = math.floor(prev * tonumber(ARGV[3*i-2]) + curr + 0.5)
+	result[2*i] = curr
+	result[2*i+1] = prev
+	if rate >= tonumber(ARGV[3*i-1]) then
+		ok = 0
+	end
+end
+if ok == 1 then
+	for i = 1, n do
+		redis.call('INCR', KEYS[2*i-1])
+		redis.call('PEXPIRE', KEYS[2*i-1], ARGV[3*i])
+	end
+end
+result[1] = ok
+return result
+`)
+
+type redisCounter struct {
+	rd     *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+var (
+	_ MultiCounter = &redisCounter{}
+	_ ResetCounter = &redisCounter{}
+)
+
+// NewRedisLimitCounter keeps counts in redis under prefix, so that every
+// instance of the app counts against the same limits. Counts from
+// Increment expire after ttl, which must be at least twice the longest
+// window; those of a Policy expire after twice their own window.
+func NewRedisLimitCounter(rd *redis.Client, prefix string, ttl time.Duration) LimitCounter {
+	return &redisCounter{rd: rd, prefix: prefix, ttl: ttl}
+}
+
+func (c *redisCounter) key(key string, window time.Time) string {
+	return c.prefix + strconv.FormatUint(LimitCounterKey(key, window), 36)
+}
+
+func (c *redisCounter) Increment(ctx context.Context, key string, currentWindow time.Time) error {
+	k := c.key(key, currentWindow)
+
+	pipe := c.rd.TxPipeline()
+	pipe.Incr(ctx, k)
+	pipe.Expire(ctx, k, c.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *redisCounter) Get(ctx context.Context, key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	values, err := c.rd.MGet(ctx, c.key(key, currentWindow), c.key(key, previousWindow)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	counts := make([]int, 2)
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			if counts[i], err = strconv.Atoi(s); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+func (c *redisCounter) Reset(ctx context.Context, key string, windows ...time.Time) error {
+	keys := make([]string, len(windows))
+	for i, w := range windows {
+		keys[i] = c.key(key, w)
+	}
+	return c.rd.Del(ctx, keys...).Err()
+}
+
+func (c *redisCounter) TakeAll(ctx context.Context, now time.Time, takes []Take) ([]Counts, bool, error) {
+	keys := make([]string, 0, 2*len(takes))
+	args := make([]interface{}, 0, 3*len(takes))
+	for _, t := range takes {
+		currentWindow := now.Truncate(t.Length)
+		keys = append(keys, c.key(t.Key, currentWindow), c.key(t.Key, currentWindow.Add(-t.Length)))
+		args = append(args,
+			strconv.FormatFloat(prevWeight(now, t.Length), 'f', -1, 64),
+			t.Limit,
+			(2 * t.Length).Milliseconds(),
+		)
+	}
+
+	res, err := takeAllScript.Run(ctx, c.rd, keys, args...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	values, _ := res.([]interface{})
+	if len(values) != 2*len(takes)+1 {
+		return nil, false, errors.Errorf("unexpected reply from limit script: %v", res)
+	}
+	counts := make([]Counts, len(takes))
+	for i := range takes {
+		curr, _ := values[2*i+1].(int64)
+		prev, _ := values[2*i+2].(int64)
+		counts[i] = Counts{Curr: int(curr), Prev: int(prev)}
+	}
+	ok, _ := values[0].(int64)
+	return counts, ok == 1, nil
+}
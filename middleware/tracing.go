@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Trace starts a server span for every request, continuing any W3C
+// traceparent sent by the caller. It must run after middleware.RequestID so
+// the span can be tagged with the request ID.
+func Trace(service string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		tagged := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			if reqID := chimiddleware.GetReqID(r.Context()); reqID != "" {
+				span.SetAttributes(pkg.AttrRequestID.String(reqID))
+			}
+
+			next.ServeHTTP(w, r)
+
+			// the route pattern is only known once chi has routed the request
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if pattern := rctx.RoutePattern(); pattern != "" {
+					span.SetName(r.Method + " " + pattern)
+					span.SetAttributes(semconv.HTTPRouteKey.String(pattern))
+				}
+			}
+		})
+
+		return otelhttp.NewHandler(tagged, service)
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import "net/http"
+
+// Unless applies mw to every request for which skip reports false. Long
+// lived streams use it to step around the request timeouts.
+func Unless(skip func(r *http.Request) bool, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/felixge/httpsnoop"
+	"github.com/go-chi/chi"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Deprecation is the retirement schedule of a route. A zero Deprecation or
+// Sunset leaves the matching header out.
+type Deprecation struct {
+	Deprecation time.Time
+	Sunset      time.Time
+	Link        string
+}
+
+// Version tags every response with an API-Version header. Routes found in
+// deprecations, keyed "METHOD /pattern" relative to where the versioned
+// router is mounted, also get Deprecation, Sunset and Link headers.
+func Version(version string, deprecations map[string]Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rctx := chi.RouteContext(r.Context())
+			mount := strings.TrimSuffix(rctx.RoutePattern(), "/*")
+
+			// the full route pattern is only known once the request has been
+			// routed, so headers are added just before they are written
+			var once bool
+			setHeaders := func() {
+				if once {
+					return
+				}
+				once = true
+
+				h := w.Header()
+				h.Set("API-Version", version)
+
+				route := r.Method + " " + strings.TrimPrefix(rctx.RoutePattern(), mount)
+				d, ok := deprecations[route]
+				if !ok {
+					return
+				}
+				if !d.Deprecation.IsZero() {
+					h.Set("Deprecation", fmt.Sprintf("@%d", d.Deprecation.Unix()))
+				}
+				if !d.Sunset.IsZero() {
+					h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+				}
+				if d.Link != "" {
+					h.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+				}
+			}
+
+			ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+				WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+					return func(code int) {
+						setHeaders()
+						next(code)
+					}
+				},
+				Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+					return func(b []byte) (int, error) {
+						setHeaders()
+						return next(b)
+					}
+				},
+			})
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
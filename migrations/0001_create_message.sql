@@ -0,0 +1,20 @@
+-- Messages kept by the outbound service. Scheduled messages wait here until
+-- a scheduler claims them by setting locked_until, so several dynos can run
+-- the scheduler without sending a message twice.
+CREATE TABLE IF NOT EXISTS message (
+    id           BIGSERIAL PRIMARY KEY,
+    account_id   BIGINT      NOT NULL REFERENCES account (id),
+    from_number  VARCHAR(16) NOT NULL,
+    to_number    VARCHAR(16) NOT NULL,
+    text         TEXT        NOT NULL,
+    status       VARCHAR(16) NOT NULL,
+    error        TEXT,
+    client_ip    VARCHAR(64) NOT NULL DEFAULT '',
+    send_at      TIMESTAMPTZ,
+    sent_at      TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS message_due_idx ON message (send_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS message_account_idx ON message (account_id, created_at);
@@ -0,0 +1,26 @@
+-- Account message templates. Every update adds a row to
+-- message_template_version and bumps message_template.version, so a sent
+-- message can always be traced to the exact text it was rendered from.
+CREATE TABLE IF NOT EXISTS message_template (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT      NOT NULL REFERENCES account (id),
+    name       VARCHAR(64) NOT NULL,
+    version    INT         NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS message_template_account_idx ON message_template (account_id) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS message_template_version (
+    template_id BIGINT      NOT NULL REFERENCES message_template (id),
+    version     INT         NOT NULL,
+    body        TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (template_id, version)
+);
+
+ALTER TABLE message
+    ADD COLUMN IF NOT EXISTS template_id      BIGINT REFERENCES message_template (id),
+    ADD COLUMN IF NOT EXISTS template_version INT;
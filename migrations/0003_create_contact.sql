@@ -0,0 +1,29 @@
+-- Account contacts and the groups they are organised in. Numbers are kept
+-- without the leading + of E.164, as numbers are everywhere else in the API.
+CREATE TABLE IF NOT EXISTS contact (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT       NOT NULL REFERENCES account (id),
+    number     VARCHAR(16)  NOT NULL,
+    name       VARCHAR(128) NOT NULL DEFAULT '',
+    attributes JSONB        NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    UNIQUE (account_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS contact_group (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT      NOT NULL REFERENCES account (id),
+    name       VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS contact_group_account_idx ON contact_group (account_id);
+
+CREATE TABLE IF NOT EXISTS contact_group_member (
+    group_id   BIGINT NOT NULL REFERENCES contact_group (id) ON DELETE CASCADE,
+    contact_id BIGINT NOT NULL REFERENCES contact (id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, contact_id)
+);
+
+CREATE INDEX IF NOT EXISTS contact_group_member_contact_idx ON contact_group_member (contact_id);
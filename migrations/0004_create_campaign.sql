@@ -0,0 +1,39 @@
+-- Campaigns send one message to an audience at a set rate. The audience is
+-- copied into campaign_recipient when the campaign starts, and runners
+-- lease running campaigns through locked_until like the message scheduler.
+CREATE TABLE IF NOT EXISTS campaign (
+    id              BIGSERIAL PRIMARY KEY,
+    account_id      BIGINT       NOT NULL REFERENCES account (id),
+    name            VARCHAR(64)  NOT NULL,
+    text            TEXT         NOT NULL DEFAULT '',
+    template_id     BIGINT REFERENCES message_template (id),
+    variables       JSONB        NOT NULL DEFAULT '{}',
+    numbers         JSONB        NOT NULL DEFAULT '[]',
+    group_id        BIGINT REFERENCES contact_group (id) ON DELETE SET NULL,
+    senders         JSONB        NOT NULL,
+    rate_per_minute INT          NOT NULL,
+    status          VARCHAR(16)  NOT NULL,
+    client_ip       VARCHAR(64)  NOT NULL DEFAULT '',
+    locked_until    TIMESTAMPTZ,
+    last_run_at     TIMESTAMPTZ,
+    started_at      TIMESTAMPTZ,
+    completed_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS campaign_account_idx ON campaign (account_id, created_at);
+CREATE INDEX IF NOT EXISTS campaign_running_idx ON campaign (id) WHERE status = 'running';
+
+CREATE TABLE IF NOT EXISTS campaign_recipient (
+    campaign_id BIGINT      NOT NULL REFERENCES campaign (id),
+    number      VARCHAR(16) NOT NULL,
+    status      VARCHAR(16) NOT NULL,
+    from_number VARCHAR(16),
+    message_id  BIGINT REFERENCES message (id),
+    error       TEXT,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (campaign_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS campaign_recipient_pending_idx ON campaign_recipient (campaign_id) WHERE status = 'pending';
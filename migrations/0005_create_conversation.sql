@@ -0,0 +1,34 @@
+-- Conversations pair one of an account's numbers with a remote number.
+-- Every message, inbound or outbound, belongs to the conversation of its
+-- pair; unread counts inbound messages since the conversation was last
+-- marked read.
+CREATE TABLE IF NOT EXISTS conversation (
+    id              BIGSERIAL PRIMARY KEY,
+    account_id      BIGINT      NOT NULL REFERENCES account (id),
+    account_number  VARCHAR(16) NOT NULL,
+    remote_number   VARCHAR(16) NOT NULL,
+    unread          INT         NOT NULL DEFAULT 0,
+    last_message_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (account_id, account_number, remote_number)
+);
+
+CREATE INDEX IF NOT EXISTS conversation_recent_idx ON conversation (account_id, last_message_at DESC);
+
+ALTER TABLE message
+    ADD COLUMN IF NOT EXISTS direction       VARCHAR(8) NOT NULL DEFAULT 'outbound',
+    ADD COLUMN IF NOT EXISTS conversation_id BIGINT REFERENCES conversation (id);
+
+CREATE INDEX IF NOT EXISTS message_conversation_idx ON message (conversation_id, id);
+
+-- every message stored so far is outbound
+INSERT INTO conversation (account_id, account_number, remote_number, last_message_at)
+SELECT account_id, from_number, to_number, max(created_at) FROM message
+WHERE conversation_id IS NULL
+GROUP BY account_id, from_number, to_number
+ON CONFLICT DO NOTHING;
+
+UPDATE message m SET conversation_id = c.id
+FROM conversation c
+WHERE m.conversation_id IS NULL
+  AND c.account_id = m.account_id AND c.account_number = m.from_number AND c.remote_number = m.to_number;
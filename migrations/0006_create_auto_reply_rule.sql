@@ -0,0 +1,24 @@
+-- Auto-reply rules answer inbound messages to one of an account's numbers.
+-- The highest priority enabled rule matching a message replies; how often
+-- it may reply to the same remote number is rate limited in redis.
+CREATE TABLE IF NOT EXISTS auto_reply_rule (
+    id             BIGSERIAL PRIMARY KEY,
+    account_id     BIGINT       NOT NULL REFERENCES account (id),
+    number         VARCHAR(16)  NOT NULL,
+    name           VARCHAR(64)  NOT NULL,
+    match_type     VARCHAR(8)   NOT NULL,
+    pattern        VARCHAR(256) NOT NULL,
+    reply          TEXT         NOT NULL,
+    tag            VARCHAR(64),
+    priority       INT          NOT NULL DEFAULT 0,
+    max_replies    INT          NOT NULL,
+    window_seconds INT          NOT NULL,
+    enabled        BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS auto_reply_rule_number_idx ON auto_reply_rule (account_id, number, priority DESC) WHERE enabled;
+
+-- contacts can be tagged by the rules they trigger
+ALTER TABLE contact ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,26 @@
+-- Plans cap how many messages an account sends per second, hour and day,
+-- from each of its senders and in total. A cap of 0 means there is none.
+-- The limiter reads plans through a one minute cache, so edits here apply
+-- without a redeploy.
+CREATE TABLE IF NOT EXISTS plan (
+    id                 BIGSERIAL PRIMARY KEY,
+    name               VARCHAR(64) NOT NULL UNIQUE,
+    sender_per_second  INT         NOT NULL DEFAULT 0,
+    sender_per_hour    INT         NOT NULL DEFAULT 0,
+    sender_per_day     INT         NOT NULL DEFAULT 0,
+    account_per_second INT         NOT NULL DEFAULT 0,
+    account_per_hour   INT         NOT NULL DEFAULT 0,
+    account_per_day    INT         NOT NULL DEFAULT 0,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- free keeps the former limit of 50 messages a day per sender and is the
+-- plan of accounts without one
+INSERT INTO plan (name, sender_per_second, sender_per_hour, sender_per_day, account_per_second, account_per_hour, account_per_day)
+VALUES ('free', 0, 0, 50, 0, 0, 0),
+       ('growth', 5, 1000, 5000, 20, 5000, 50000),
+       ('enterprise', 50, 20000, 200000, 200, 100000, 1000000)
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE account ADD COLUMN IF NOT EXISTS plan_id BIGINT REFERENCES plan (id);
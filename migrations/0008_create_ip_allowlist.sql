@@ -0,0 +1,23 @@
+-- IP allowlists lock an account's credentials to its own addresses. An
+-- account without entries may call the API from anywhere.
+CREATE TABLE IF NOT EXISTS ip_allowlist (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT      NOT NULL REFERENCES account (id),
+    cidr       VARCHAR(43) NOT NULL,
+    label      VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (account_id, cidr)
+);
+
+-- The audit log records changes to an account's settings and the address
+-- they were made from.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT      NOT NULL REFERENCES account (id),
+    action     VARCHAR(64) NOT NULL,
+    details    JSONB       NOT NULL DEFAULT '{}',
+    client_ip  VARCHAR(45) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_account_idx ON audit_log (account_id, created_at DESC);
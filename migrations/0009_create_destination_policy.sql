@@ -0,0 +1,27 @@
+-- Destination policies say whether an account may send to a country, by
+-- its ISO 3166-1 alpha-2 code, and how many messages a day. Rows without
+-- an account are the default policy set by admins; country '*' stands for
+-- every country without a row of its own, and '001' for numbers of no
+-- country such as satellite phones. A daily cap of 0 means there is none.
+--
+-- A message follows the first of: the account's row for its country, the
+-- account's '*' row, the default row for its country, the default '*' row.
+-- Countries no row covers are enabled without a cap.
+CREATE TABLE IF NOT EXISTS destination_policy (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT REFERENCES account (id),
+    country    VARCHAR(3)  NOT NULL,
+    enabled    BOOLEAN     NOT NULL,
+    daily_cap  INT         NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS destination_policy_account_country_idx
+    ON destination_policy (COALESCE(account_id, 0), country);
+
+-- premium satellite and international numbers are the first targets of
+-- SMS pumping, so accounts have to opt in to them
+INSERT INTO destination_policy (account_id, country, enabled)
+VALUES (NULL, '001', false)
+ON CONFLICT (COALESCE(account_id, 0), country) DO NOTHING;
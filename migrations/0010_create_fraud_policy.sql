@@ -0,0 +1,17 @@
+-- Fraud policies say what happens to an account's outbound messages whose
+-- fraud score reaches threshold: 'flag' only logs them, 'hold' keeps them
+-- for review and 'reject' refuses them. Accounts without a row hold
+-- messages scoring 50 or more.
+CREATE TABLE IF NOT EXISTS fraud_policy (
+    account_id BIGINT PRIMARY KEY REFERENCES account (id),
+    action     VARCHAR(8)  NOT NULL CHECK (action IN ('flag', 'hold', 'reject')),
+    threshold  INT         NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Held messages keep the score and signals that held them, for reviewers.
+ALTER TABLE message ADD COLUMN IF NOT EXISTS fraud_score INT;
+ALTER TABLE message ADD COLUMN IF NOT EXISTS fraud_signals VARCHAR(128);
+
+CREATE INDEX IF NOT EXISTS message_held_idx ON message (created_at) WHERE status = 'held';
@@ -4,4 +4,21 @@ type Account struct {
 	ID       int64  `json:"id"`
 	AuthId   string `json:"auth_id" db:"auth_id"`
 	Username string `json:"username" db:"username"`
+	PlanID   *int64 `json:"plan_id,omitempty" db:"plan_id"`
+}
+
+// DefaultPlan is the plan of accounts that have none of their own.
+const DefaultPlan = "free"
+
+// Plan caps how many messages an account sends, from each of its senders
+// and in total. A cap of 0 means there is none.
+type Plan struct {
+	ID               int64  `json:"id"`
+	Name             string `json:"name" db:"name"`
+	SenderPerSecond  int    `json:"sender_per_second" db:"sender_per_second"`
+	SenderPerHour    int    `json:"sender_per_hour" db:"sender_per_hour"`
+	SenderPerDay     int    `json:"sender_per_day" db:"sender_per_day"`
+	AccountPerSecond int    `json:"account_per_second" db:"account_per_second"`
+	AccountPerHour   int    `json:"account_per_hour" db:"account_per_hour"`
+	AccountPerDay    int    `json:"account_per_day" db:"account_per_day"`
 }
@@ -0,0 +1,52 @@
+package account
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PlanCache keeps the plans of accounts for ttl, so the limits checked on
+// every message follow edits to the plan table within ttl without a
+// lookup per message.
+type PlanCache struct {
+	find func(context.Context, int64) (*Plan, error)
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[int64]cachedPlan
+}
+
+type cachedPlan struct {
+	plan      Plan
+	expiresAt time.Time
+}
+
+func NewPlanCache(repo Repository, ttl time.Duration) *PlanCache {
+	return &PlanCache{find: repo.FindPlan, ttl: ttl, entries: map[int64]cachedPlan{}}
+}
+
+// Find returns the plan of the account, looking it up again once the
+// cached one is older than ttl.
+func (c *PlanCache) Find(ctx context.Context, accountId int64) (*Plan, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[accountId]
+	c.mu.Unlock()
+	if ok && now.Before(e.expiresAt) {
+		p := e.plan
+		return &p, nil
+	}
+
+	p, err := c.find(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[accountId] = cachedPlan{plan: *p, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return p, nil
+}
@@ -1,8 +1,8 @@
 package account
 
 import (
-	"fmt"
-	"github.com/go-redis/redis"
+	"context"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -11,7 +11,8 @@ var (
 )
 
 type Repository interface {
-	FindByUsername(string) (*Account, error)
+	FindByUsername(ctx context.Context, username string) (*Account, error)
+	FindPlan(ctx context.Context, accountId int64) (*Plan, error)
 }
 
 type repository struct {
@@ -23,14 +24,28 @@ func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
 	return &repository{db: db, rd: rd}
 }
 
-func (r repository) FindByUsername(username string) (*Account, error) {
+func (r repository) FindByUsername(ctx context.Context, username string) (*Account, error) {
 	var s Account
 
-	fmt.Println(username)
-	err := r.db.Get(&s, `SELECT * FROM account WHERE username = $1`, username)
+	err := r.db.GetContext(ctx, &s, `SELECT * FROM account WHERE username = $1`, username)
 	if err != nil {
 		return nil, err
 	}
 
 	return &s, nil
 }
+
+// FindPlan returns the plan of the account, or the default plan when it
+// has none.
+func (r repository) FindPlan(ctx context.Context, accountId int64) (*Plan, error) {
+	var p Plan
+
+	err := r.db.GetContext(ctx, &p, `SELECT p.* FROM plan p
+		WHERE p.id = COALESCE((SELECT plan_id FROM account WHERE id = $1), (SELECT id FROM plan WHERE name = $2))`,
+		accountId, DefaultPlan)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,66 @@
+package allowlist
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.svc.list(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, entries)
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req EntryReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	entry, err := h.svc.create(r.Context(), req, middleware2.ClientIP(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, entry)
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid allowlist entry id")))
+		return
+	}
+
+	if err := h.svc.delete(r.Context(), id, middleware2.ClientIP(r)); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "allowlist entry deleted")
+}
+
+func (h Handler) audit(w http.ResponseWriter, r *http.Request) {
+	events, err := h.svc.audit(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, events)
+}
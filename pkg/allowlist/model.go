@@ -0,0 +1,96 @@
+package allowlist
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Audit actions.
+const (
+	ActionAdd    = "allowlist.add"
+	ActionRemove = "allowlist.remove"
+)
+
+// auditLimit is how many audit events are listed.
+const auditLimit = 100
+
+// Entry lets the account's credentials be used from the addresses of CIDR.
+// Accounts without entries may use them from anywhere.
+type Entry struct {
+	ID        int64     `json:"id" db:"id"`
+	AccountID int64     `json:"-" db:"account_id"`
+	CIDR      string    `json:"cidr" db:"cidr"`
+	Label     *string   `json:"label,omitempty" db:"label"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// contains reports whether any of entries includes ip.
+func contains(entries []Entry, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, e := range entries {
+		if _, n, err := net.ParseCIDR(e.CIDR); err == nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// EntryReq adds a CIDR, or a single address, to the allowlist.
+type EntryReq struct {
+	CIDR  string  `json:"cidr"`
+	Label *string `json:"label,omitempty"`
+}
+
+func (v *EntryReq) Bind(r *http.Request) error {
+	v.CIDR = strings.TrimSpace(v.CIDR)
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "cidr", Field: v.CIDR, Message: fmt.Sprintf("%s is missing", "cidr")},
+	)
+
+	if v.CIDR != "" {
+		cidr, err := canonical(v.CIDR)
+		if err != nil {
+			err1.Add("cidr", "cidr must be an IPv4 or IPv6 address or network, such as 203.0.113.0/24")
+		}
+		v.CIDR = cidr
+	}
+
+	if v.Label != nil && len(*v.Label) > 64 {
+		err1.Add("label", "label is invalid")
+	}
+
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+// canonical returns the network of cidr in its shortest form, with the host
+// bits cleared, so the same network is stored once. A single address is
+// a network of its own.
+func canonical(cidr string) (string, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return "", &net.ParseError{Type: "IP address", Text: cidr}
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
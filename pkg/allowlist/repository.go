@@ -0,0 +1,98 @@
+package allowlist
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg/audit"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	list(ctx context.Context, accountId int64) ([]Entry, error)
+	create(ctx context.Context, accountId int64, req EntryReq, clientIP string) (*Entry, error)
+	delete(ctx context.Context, id, accountId int64, clientIP string) (*Entry, error)
+	audit(ctx context.Context, accountId int64) ([]audit.Event, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+func (r repository) list(ctx context.Context, accountId int64) ([]Entry, error) {
+	entries := []Entry{}
+	err := r.db.SelectContext(ctx, &entries, `SELECT * FROM ip_allowlist WHERE account_id = $1 ORDER BY id`, accountId)
+	return entries, err
+}
+
+// create returns nil when the CIDR is already on the allowlist. The change
+// is audited in the same transaction.
+func (r repository) create(ctx context.Context, accountId int64, req EntryReq, clientIP string) (*Entry, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var entry Entry
+	err = tx.GetContext(ctx, &entry, `INSERT INTO ip_allowlist (account_id, cidr, label) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id, cidr) DO NOTHING RETURNING *`, accountId, req.CIDR, req.Label)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := audit.Record(ctx, tx, event(ActionAdd, entry, clientIP)); err != nil {
+		return nil, err
+	}
+	return &entry, tx.Commit()
+}
+
+// delete returns nil when the account has no such entry. The change is
+// audited in the same transaction.
+func (r repository) delete(ctx context.Context, id, accountId int64, clientIP string) (*Entry, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var entry Entry
+	err = tx.GetContext(ctx, &entry, `DELETE FROM ip_allowlist WHERE id = $1 AND account_id = $2 RETURNING *`,
+		id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := audit.Record(ctx, tx, event(ActionRemove, entry, clientIP)); err != nil {
+		return nil, err
+	}
+	return &entry, tx.Commit()
+}
+
+func (r repository) audit(ctx context.Context, accountId int64) ([]audit.Event, error) {
+	return audit.List(ctx, r.db, accountId, "allowlist.", auditLimit)
+}
+
+func event(action string, e Entry, clientIP string) audit.Event {
+	details := audit.Details{"id": fmt.Sprint(e.ID), "cidr": e.CIDR}
+	if e.Label != nil {
+		details["label"] = *e.Label
+	}
+	return audit.Event{AccountID: e.AccountID, Action: action, Details: details, ClientIP: clientIP}
+}
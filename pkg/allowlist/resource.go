@@ -0,0 +1,33 @@
+package allowlist
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	hndlr := NewHandler(NewService(NewRepository(rs.db, rs.rd)))
+
+	r.Get("/", hndlr.list)
+	r.Post("/", hndlr.create)
+	r.Delete("/{id}", hndlr.delete)
+	r.Get("/audit", hndlr.audit)
+
+	return r
+}
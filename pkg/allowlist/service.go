@@ -0,0 +1,113 @@
+package allowlist
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/audit"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	list(ctx context.Context) ([]Entry, error)
+	create(ctx context.Context, req EntryReq, clientIP string) (*Entry, error)
+	delete(ctx context.Context, id int64, clientIP string) error
+	audit(ctx context.Context) ([]audit.Event, error)
+	// Allows reports whether the account may call the API from ip: it has
+	// no allowlist, or ip is on it.
+	Allows(ctx context.Context, accountId int64, ip string) (bool, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+// lockout refuses changes after which the caller's own address could no
+// longer use the account.
+func lockout(ip string) error {
+	return pkg.WithStatus(http.StatusUnprocessableEntity,
+		errors.Errorf("the allowlist would no longer include your address %s", ip))
+}
+
+func (s service) list(ctx context.Context) ([]Entry, error) {
+	return s.repo.list(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) create(ctx context.Context, req EntryReq, clientIP string) (*Entry, error) {
+	accountId := pkg.AccountID(ctx)
+
+	entries, err := s.repo.list(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+	// the first entry closes the account to every other address
+	if len(entries) == 0 && !contains([]Entry{{CIDR: req.CIDR}}, clientIP) {
+		return nil, lockout(clientIP)
+	}
+
+	entry, err := s.repo.create(ctx, accountId, req, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, pkg.WithStatus(http.StatusConflict, errors.Errorf("%s is already on the allowlist", req.CIDR))
+	}
+	pkg.Logger(ctx).WithField("cidr", entry.CIDR).WithField("client_ip", clientIP).Info("ip allowlist: entry added")
+	return entry, nil
+}
+
+func (s service) delete(ctx context.Context, id int64, clientIP string) error {
+	accountId := pkg.AccountID(ctx)
+
+	entries, err := s.repo.list(ctx, accountId)
+	if err != nil {
+		return err
+	}
+	found := false
+	remaining := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.ID == id {
+			found = true
+			continue
+		}
+		remaining = append(remaining, e)
+	}
+	if !found {
+		return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no allowlist entry with id %d", id))
+	}
+	// removing the last entry opens the account again
+	if len(remaining) > 0 && !contains(remaining, clientIP) {
+		return lockout(clientIP)
+	}
+
+	entry, err := s.repo.delete(ctx, id, accountId, clientIP)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no allowlist entry with id %d", id))
+	}
+	pkg.Logger(ctx).WithField("cidr", entry.CIDR).WithField("client_ip", clientIP).Info("ip allowlist: entry removed")
+	return nil
+}
+
+func (s service) audit(ctx context.Context) ([]audit.Event, error) {
+	return s.repo.audit(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) Allows(ctx context.Context, accountId int64, ip string) (bool, error) {
+	entries, err := s.repo.list(ctx, accountId)
+	if err != nil {
+		return false, err
+	}
+	return len(entries) == 0 || contains(entries, ip), nil
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"errors"
 	"github.com/go-chi/render"
 	"net/http"
 )
@@ -8,6 +9,33 @@ import (
 type Response struct {
 	Message interface{} `json:"message,omitempty"`
 	Err     interface{} `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
+}
+
+// StatusError is an error rendered with its own HTTP status instead of 500,
+// and a Code clients can tell it apart by when it has one.
+type StatusError struct {
+	Status int
+	Code   string
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// WithStatus wraps err so Render responds with status.
+func WithStatus(status int, err error) error {
+	return &StatusError{Status: status, Err: err}
+}
+
+// WithCode wraps err so Render responds with status and code.
+func WithCode(status int, code string, err error) error {
+	return &StatusError{Status: status, Code: code, Err: err}
 }
 
 func Render(w http.ResponseWriter, r *http.Request, res interface{}) {
@@ -16,8 +44,13 @@ func Render(w http.ResponseWriter, r *http.Request, res interface{}) {
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, Response{Message: res.(render.Renderer), Err: ""})
 	case error:
-		w.WriteHeader(http.StatusInternalServerError)
-		render.JSON(w, r, Response{Message: "", Err: res.(error).Error()})
+		status, code := http.StatusInternalServerError, ""
+		var se *StatusError
+		if errors.As(res.(error), &se) {
+			status, code = se.Status, se.Code
+		}
+		w.WriteHeader(status)
+		render.JSON(w, r, Response{Message: "", Err: res.(error).Error(), Code: code})
 	default:
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, Response{Message: res, Err: ""})
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Details describe what an audited change changed, kept as JSONB.
+type Details map[string]string
+
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+func (d *Details) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case nil:
+		*d = Details{}
+		return nil
+	}
+	return errors.Errorf("cannot scan %T into details", src)
+}
+
+// Event is a change made to an account's settings, and the address it was
+// made from.
+type Event struct {
+	ID        int64     `json:"id" db:"id"`
+	AccountID int64     `json:"-" db:"account_id"`
+	Action    string    `json:"action" db:"action"`
+	Details   Details   `json:"details" db:"details"`
+	ClientIP  string    `json:"client_ip" db:"client_ip"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+// Record stores e with ex, which should be the transaction making the
+// change e records so that neither is kept without the other.
+func Record(ctx context.Context, ex sqlx.ExecerContext, e Event) error {
+	_, err := ex.ExecContext(ctx, `INSERT INTO audit_log (account_id, action, details, client_ip)
+		VALUES ($1, $2, $3, $4)`, e.AccountID, e.Action, e.Details, e.ClientIP)
+	return err
+}
+
+// List returns the latest limit events of an account whose action starts
+// with prefix, newest first.
+func List(ctx context.Context, q sqlx.QueryerContext, accountId int64, prefix string, limit int) ([]Event, error) {
+	events := []Event{}
+	err := sqlx.SelectContext(ctx, q, &events, `SELECT * FROM audit_log
+		WHERE account_id = $1 AND action LIKE $2 || '%'
+		ORDER BY created_at DESC, id DESC LIMIT $3`, accountId, prefix, limit)
+	return events, err
+}
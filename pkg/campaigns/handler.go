@@ -0,0 +1,95 @@
+package campaigns
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func campaignID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid campaign id"))
+	}
+	return id, nil
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req CampaignReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	// kept so the rate limit can be applied as for a direct send
+	clientIP, err := middleware2.KeyByIP(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	c, err := h.svc.create(r.Context(), req, clientIP)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, c)
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.svc.list(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, campaigns)
+}
+
+func (h Handler) find(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, h.svc.find)
+}
+
+func (h Handler) start(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, h.svc.start)
+}
+
+func (h Handler) pause(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, h.svc.pause)
+}
+
+func (h Handler) resume(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, h.svc.resume)
+}
+
+func (h Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, h.svc.cancel)
+}
+
+// act applies fn to the campaign in the URL and renders the result.
+func (h Handler) act(w http.ResponseWriter, r *http.Request, fn func(context.Context, int64) (*Campaign, error)) {
+	id, err := campaignID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	c, err := fn(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, c)
+}
@@ -0,0 +1,199 @@
+package campaigns
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxAudience bounds the numbers listed in a campaign.
+	MaxAudience = 10000
+	// MaxSenders bounds the sender pool of a campaign.
+	MaxSenders = 20
+	// MaxRate bounds the messages a campaign sends per minute.
+	MaxRate = 600
+)
+
+// Campaign statuses.
+const (
+	StatusDraft     = "draft"
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+// Recipient statuses.
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+	RecipientSkipped = "skipped"
+)
+
+// Numbers is a list of phone numbers kept as JSONB.
+type Numbers []string
+
+func (n Numbers) Value() (driver.Value, error) {
+	if n == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(n)
+}
+
+func (n *Numbers) Scan(src interface{}) error {
+	return scanJSON(src, n)
+}
+
+// Variables are the template variables of a campaign, kept as JSONB.
+type Variables map[string]string
+
+func (v Variables) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+func (v *Variables) Scan(src interface{}) error {
+	return scanJSON(src, v)
+}
+
+func scanJSON(src, dst interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	case nil:
+		return nil
+	}
+	return errors.Errorf("cannot scan %T into %T", src, dst)
+}
+
+// Progress counts the recipients of a campaign by status.
+type Progress struct {
+	Total   int `json:"total" db:"total"`
+	Pending int `json:"pending" db:"pending"`
+	Sent    int `json:"sent" db:"sent"`
+	Failed  int `json:"failed" db:"failed"`
+	Skipped int `json:"skipped" db:"skipped"`
+}
+
+// Campaign sends one message, text or template, to an audience of numbers
+// or a contact group, spread over a pool of senders at a set rate.
+type Campaign struct {
+	ID            int64      `json:"id" db:"id"`
+	AccountID     int64      `json:"-" db:"account_id"`
+	Name          string     `json:"name" db:"name"`
+	Text          string     `json:"text,omitempty" db:"text"`
+	TemplateID    *int64     `json:"template_id,omitempty" db:"template_id"`
+	Variables     Variables  `json:"variables,omitempty" db:"variables"`
+	To            Numbers    `json:"to,omitempty" db:"numbers"`
+	GroupID       *int64     `json:"group_id,omitempty" db:"group_id"`
+	Senders       Numbers    `json:"senders" db:"senders"`
+	RatePerMinute int        `json:"rate_per_minute" db:"rate_per_minute"`
+	Status        string     `json:"status" db:"status"`
+	ClientIP      string     `json:"-" db:"client_ip"`
+	LastRunAt     *time.Time `json:"-" db:"last_run_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+	Progress      `json:"progress"`
+}
+
+// CampaignReq creates a draft campaign.
+type CampaignReq struct {
+	Name          string            `json:"name"`
+	Text          string            `json:"text,omitempty"`
+	TemplateID    *int64            `json:"template_id,omitempty"`
+	Variables     map[string]string `json:"variables,omitempty"`
+	To            []string          `json:"to,omitempty"`
+	GroupID       *int64            `json:"group_id,omitempty"`
+	Senders       []string          `json:"senders"`
+	RatePerMinute int               `json:"rate_per_minute"`
+}
+
+func (v *CampaignReq) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%s is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Min: 1, Max: 64, Message: fmt.Sprintf("%s is invalid", "name")},
+		&validators.IntIsGreaterThan{Name: "rate_per_minute", Field: v.RatePerMinute, Compared: 0, Message: fmt.Sprintf("%s is missing", "rate_per_minute")},
+		&validators.IntIsLessThan{Name: "rate_per_minute", Field: v.RatePerMinute, Compared: MaxRate + 1, Message: fmt.Sprintf("rate_per_minute may be at most %d", MaxRate)},
+	)
+
+	switch {
+	case v.Text != "" && v.TemplateID != nil:
+		err1.Add("text", "send either text or template_id, not both")
+	case v.Text == "" && v.TemplateID == nil:
+		err1.Add("text", "text or template_id is missing")
+	case v.Text != "":
+		// the same limits as a single message; templates are checked when
+		// rendered
+		if length, gsm7 := pkg.SMSLength(v.Text); gsm7 && length > pkg.MaxGSM7Length {
+			err1.Add("text", fmt.Sprintf("text may be at most %d characters", pkg.MaxGSM7Length))
+		} else if !gsm7 && length > pkg.MaxUCS2Length {
+			err1.Add("text", fmt.Sprintf("text may be at most %d characters when it uses characters outside the GSM alphabet", pkg.MaxUCS2Length))
+		}
+	}
+
+	switch {
+	case len(v.To) > 0 && v.GroupID != nil:
+		err1.Add("to", "send either to or group_id, not both")
+	case len(v.To) == 0 && v.GroupID == nil:
+		err1.Add("to", "to or group_id is missing")
+	case len(v.To) > MaxAudience:
+		err1.Add("to", fmt.Sprintf("a campaign may list at most %d numbers", MaxAudience))
+	}
+	for i, n := range v.To {
+		number, err := contacts.NormalizeNumber(n)
+		if err != nil {
+			err1.Add("to", err.Error())
+			continue
+		}
+		v.To[i] = number
+	}
+
+	switch {
+	case len(v.Senders) == 0:
+		err1.Add("senders", "senders is missing")
+	case len(v.Senders) > MaxSenders:
+		err1.Add("senders", fmt.Sprintf("a campaign may have at most %d senders", MaxSenders))
+	}
+	seen := map[string]bool{}
+	senders := v.Senders[:0]
+	for _, s := range v.Senders {
+		if len(s) < 6 || len(s) > 16 {
+			err1.Add("senders", fmt.Sprintf("%q is invalid", s))
+		}
+		if !seen[s] {
+			seen[s] = true
+			senders = append(senders, s)
+		}
+	}
+	v.Senders = senders
+
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+// Recipient is a number a running campaign sends to.
+type Recipient struct {
+	CampaignID int64   `json:"-" db:"campaign_id"`
+	Number     string  `json:"number" db:"number"`
+	Status     string  `json:"status" db:"status"`
+	From       *string `json:"from,omitempty" db:"from_number"`
+	MessageID  *int64  `json:"message_id,omitempty" db:"message_id"`
+	Error      *string `json:"error,omitempty" db:"error"`
+}
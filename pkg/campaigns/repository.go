@@ -0,0 +1,197 @@
+package campaigns
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	create(ctx context.Context, accountId int64, req CampaignReq, clientIP string) (*Campaign, error)
+	list(ctx context.Context, accountId int64) ([]Campaign, error)
+	find(ctx context.Context, id, accountId int64) (*Campaign, error)
+	ownedNumbers(ctx context.Context, accountId int64, numbers []string) (map[string]bool, error)
+	start(ctx context.Context, id, accountId int64, numbers []string) (bool, error)
+	transition(ctx context.Context, id, accountId int64, from []string, to string) (bool, error)
+	claimRunning(ctx context.Context, lease time.Duration, limit int) ([]Campaign, error)
+	pending(ctx context.Context, id int64, limit int) ([]Recipient, error)
+	finishRecipient(ctx context.Context, rcpt Recipient) error
+	release(ctx context.Context, id int64, ran bool) error
+	complete(ctx context.Context, id int64) (bool, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+// selectCampaign reads campaigns with their progress counters, which are
+// counted from the recipients rather than kept alongside.
+const selectCampaign = `SELECT c.*, p.* FROM campaign c
+	CROSS JOIN LATERAL (
+		SELECT count(*) AS total,
+			count(*) FILTER (WHERE r.status = 'pending') AS pending,
+			count(*) FILTER (WHERE r.status = 'sent') AS sent,
+			count(*) FILTER (WHERE r.status = 'failed') AS failed,
+			count(*) FILTER (WHERE r.status = 'skipped') AS skipped
+		FROM campaign_recipient r WHERE r.campaign_id = c.id
+	) p`
+
+func (r repository) create(ctx context.Context, accountId int64, req CampaignReq, clientIP string) (*Campaign, error) {
+	var id int64
+	err := r.db.GetContext(ctx, &id, `INSERT INTO campaign
+		(account_id, name, text, template_id, variables, numbers, group_id, senders, rate_per_minute, status, client_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		accountId, req.Name, req.Text, req.TemplateID, Variables(req.Variables), Numbers(req.To), req.GroupID,
+		Numbers(req.Senders), req.RatePerMinute, StatusDraft, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, id, accountId)
+}
+
+func (r repository) list(ctx context.Context, accountId int64) ([]Campaign, error) {
+	campaigns := []Campaign{}
+	err := r.db.SelectContext(ctx, &campaigns, selectCampaign+` WHERE c.account_id = $1 ORDER BY c.id`, accountId)
+	return campaigns, err
+}
+
+// find returns nil when the account has no such campaign.
+func (r repository) find(ctx context.Context, id, accountId int64) (*Campaign, error) {
+	var c Campaign
+	err := r.db.GetContext(ctx, &c, selectCampaign+` WHERE c.id = $1 AND c.account_id = $2`, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ownedNumbers reports which of numbers belong to the account.
+func (r repository) ownedNumbers(ctx context.Context, accountId int64, numbers []string) (map[string]bool, error) {
+	owned := make(map[string]bool, len(numbers))
+	query, args, err := sqlx.In("select number from phone_number where account_id = ? AND number IN (?)", accountId, numbers)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	if err := r.db.SelectContext(ctx, &found, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, n := range found {
+		owned[n] = true
+	}
+	return owned, nil
+}
+
+// start moves a draft campaign to running and copies its audience into the
+// recipients. It reports false when the campaign is no longer a draft.
+func (r repository) start(ctx context.Context, id, accountId int64, numbers []string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE campaign SET status = $1, started_at = now(), last_run_at = now(), updated_at = now()
+		WHERE id = $2 AND account_id = $3 AND status = $4`, StatusRunning, id, accountId, StatusDraft)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	stmt, err := tx.PreparexContext(ctx, `INSERT INTO campaign_recipient (campaign_id, number, status)
+		VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	for _, n := range numbers {
+		if _, err := stmt.ExecContext(ctx, id, n, RecipientPending); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// transition moves the campaign to status to if it is in one of from.
+func (r repository) transition(ctx context.Context, id, accountId int64, from []string, to string) (bool, error) {
+	query, args, err := sqlx.In(`UPDATE campaign SET status = ?, updated_at = now()
+		WHERE id = ? AND account_id = ? AND status IN (?)`, to, id, accountId, from)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// claimRunning leases up to limit running campaigns to the caller, skipping
+// those another runner holds.
+func (r repository) claimRunning(ctx context.Context, lease time.Duration, limit int) ([]Campaign, error) {
+	var campaigns []Campaign
+	err := r.db.SelectContext(ctx, &campaigns, `UPDATE campaign SET locked_until = now() + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM campaign
+			WHERE status = $2 AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY last_run_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, lease.Seconds(), StatusRunning, limit)
+	return campaigns, err
+}
+
+func (r repository) pending(ctx context.Context, id int64, limit int) ([]Recipient, error) {
+	var rcpts []Recipient
+	err := r.db.SelectContext(ctx, &rcpts, `SELECT * FROM campaign_recipient
+		WHERE campaign_id = $1 AND status = $2 ORDER BY number LIMIT $3`, id, RecipientPending, limit)
+	return rcpts, err
+}
+
+func (r repository) finishRecipient(ctx context.Context, rcpt Recipient) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE campaign_recipient SET status = $1, from_number = $2, message_id = $3, error = $4, updated_at = now()
+		WHERE campaign_id = $5 AND number = $6`, rcpt.Status, rcpt.From, rcpt.MessageID, rcpt.Error, rcpt.CampaignID, rcpt.Number)
+	return err
+}
+
+// release gives up the lease on a campaign. ran records that its send
+// budget was spent, so the next budget is counted from now.
+func (r repository) release(ctx context.Context, id int64, ran bool) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE campaign SET locked_until = NULL,
+		last_run_at = CASE WHEN $1 THEN now() ELSE last_run_at END
+		WHERE id = $2`, ran, id)
+	return err
+}
+
+// complete marks a running campaign completed once no recipient is pending.
+func (r repository) complete(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE campaign SET status = $1, completed_at = now(), updated_at = now()
+		WHERE id = $2 AND status = $3 AND NOT EXISTS (
+			SELECT 1 FROM campaign_recipient WHERE campaign_id = $2 AND status = $4
+		)`, StatusCompleted, id, StatusRunning, RecipientPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
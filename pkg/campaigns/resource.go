@@ -0,0 +1,38 @@
+package campaigns
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db, rs.rd)
+	svc := newService(rs.db, rs.rd, repo)
+	hndlr := NewHandler(svc)
+
+	r.Get("/", hndlr.list)
+	r.Post("/", hndlr.create)
+	r.Get("/{id}", hndlr.find)
+	r.Post("/{id}/start", hndlr.start)
+	r.Post("/{id}/pause", hndlr.pause)
+	r.Post("/{id}/resume", hndlr.resume)
+	r.Post("/{id}/cancel", hndlr.cancel)
+
+	return r
+}
@@ -0,0 +1,87 @@
+package campaigns
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/templates"
+	"time"
+)
+
+const (
+	runnerBatch = 100
+	runnerLease = time.Minute
+)
+
+// Runner sends the messages of running campaigns. Campaigns are leased in
+// the database, so every dyno can run its own Runner.
+type Runner struct {
+	repo     Repository
+	svc      Service
+	limiter  outbounds.Limiter
+	interval time.Duration
+}
+
+// NewRunner creates a runner working through running campaigns every
+// interval.
+func NewRunner(db *sqlx.DB, rd *redis.Client, limiter outbounds.Limiter, interval time.Duration) *Runner {
+	repo := NewRepository(db, rd)
+	return &Runner{
+		repo:     repo,
+		svc:      newService(db, rd, repo),
+		limiter:  limiter,
+		interval: interval,
+	}
+}
+
+// newService wires the campaign service to the outbound, template and
+// contact services it sends through.
+func newService(db *sqlx.DB, rd *redis.Client, repo Repository) Service {
+	tmpls := templates.NewService(templates.NewRepository(db, rd))
+	groups := contacts.NewService(contacts.NewRepository(db, rd))
+	outbound := outbounds.NewService(outbounds.NewRepository(db, rd), tmpls, groups)
+	return NewService(repo, outbound, tmpls, groups)
+}
+
+// Run works through running campaigns until ctx is cancelled.
+func (rn *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(rn.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rn.runDue(ctx)
+		}
+	}
+}
+
+// runDue runs one batch of campaigns, the ones that have waited longest
+// first. A campaign is released as soon as its run ends, so claiming again
+// in the same tick would only find the same campaigns.
+func (rn *Runner) runDue(ctx context.Context) {
+	log := pkg.Logger(ctx).WithField("context", "campaign_runner")
+
+	campaigns, err := rn.repo.claimRunning(ctx, runnerLease, runnerBatch)
+	if err != nil {
+		log.WithError(err).Error("unable to claim running campaigns")
+		return
+	}
+
+	for _, c := range campaigns {
+		if ctx.Err() != nil {
+			return
+		}
+		// limited as if sent directly, from the client address the
+		// campaign was created from
+		allow := outbounds.AllowFrom(ctx, rn.limiter, c.AccountID, c.ClientIP)
+		if err := rn.svc.run(ctx, c, allow); err != nil {
+			log.WithError(err).WithField("campaign_id", c.ID).Error("unable to run campaign")
+		}
+	}
+}
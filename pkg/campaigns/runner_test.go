@@ -0,0 +1,171 @@
+package campaigns
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/destinations"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/pkg/errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeRepo keeps a single running campaign and its recipients in memory.
+type fakeRepo struct {
+	Repository
+	campaign Campaign
+	rcpts    []Recipient
+	finished []Recipient
+	released bool
+}
+
+func (f *fakeRepo) claimRunning(ctx context.Context, lease time.Duration, limit int) ([]Campaign, error) {
+	return []Campaign{f.campaign}, nil
+}
+
+func (f *fakeRepo) find(ctx context.Context, id, accountId int64) (*Campaign, error) {
+	c := f.campaign
+	return &c, nil
+}
+
+func (f *fakeRepo) pending(ctx context.Context, id int64, limit int) ([]Recipient, error) {
+	var pending []Recipient
+	for _, rcpt := range f.rcpts {
+		if rcpt.Status == RecipientPending && len(pending) < limit {
+			pending = append(pending, rcpt)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeRepo) finishRecipient(ctx context.Context, rcpt Recipient) error {
+	f.finished = append(f.finished, rcpt)
+	for i := range f.rcpts {
+		if f.rcpts[i].Number == rcpt.Number {
+			f.rcpts[i] = rcpt
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) release(ctx context.Context, id int64, ran bool) error {
+	f.released = true
+	return nil
+}
+
+func (f *fakeRepo) complete(ctx context.Context, id int64) (bool, error) {
+	for _, rcpt := range f.rcpts {
+		if rcpt.Status == RecipientPending {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// fakeOutbound sends every message its limiter allows, failing those to
+// the numbers of refused with their error.
+type fakeOutbound struct {
+	outbounds.Service
+	refused map[string]error
+}
+
+func (f fakeOutbound) Send(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (*outbounds.Message, error) {
+	ok, err := allow(req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, outbounds.ErrLimited
+	}
+	if err := f.refused[req.To]; err != nil {
+		return nil, err
+	}
+	return &outbounds.Message{ID: 1}, nil
+}
+
+// fakeLimiter answers every check with ok and err.
+type fakeLimiter struct {
+	ok  bool
+	err error
+}
+
+func (l fakeLimiter) Handler(next http.Handler) http.Handler { return next }
+
+func (l fakeLimiter) Allow(r *http.Request) (bool, error) { return l.ok, l.err }
+
+func newTestRunner(limiter outbounds.Limiter, outbound outbounds.Service, numbers ...string) (*Runner, *fakeRepo) {
+	repo := &fakeRepo{
+		campaign: Campaign{ID: 1, AccountID: 1, Status: StatusRunning, Senders: []string{"+15550000001"}, RatePerMinute: 60},
+	}
+	for _, n := range numbers {
+		repo.rcpts = append(repo.rcpts, Recipient{CampaignID: 1, Number: n, Status: RecipientPending})
+	}
+	return &Runner{repo: repo, svc: NewService(repo, outbound, nil, nil), limiter: limiter}, repo
+}
+
+func TestRunnerSends(t *testing.T) {
+	rn, repo := newTestRunner(fakeLimiter{ok: true}, fakeOutbound{}, "+15550000002", "+15550000003")
+
+	rn.runDue(context.Background())
+
+	for _, rcpt := range repo.rcpts {
+		if rcpt.Status != RecipientSent {
+			t.Errorf("recipient %s is %s, want %s", rcpt.Number, rcpt.Status, RecipientSent)
+		}
+	}
+}
+
+func TestRunnerRetriesWhenLimiterUnavailable(t *testing.T) {
+	unavailable := pkg.WithStatus(http.StatusServiceUnavailable, errors.New("rate limits are unavailable, try again later"))
+	rn, repo := newTestRunner(fakeLimiter{err: unavailable}, fakeOutbound{}, "+15550000002", "+15550000003")
+
+	rn.runDue(context.Background())
+
+	if len(repo.finished) != 0 {
+		t.Fatalf("finished %+v, want every recipient left pending", repo.finished)
+	}
+	if !repo.released {
+		t.Error("campaign was not released")
+	}
+
+	// once the limiter is back, the next run sends them
+	rn.limiter = fakeLimiter{ok: true}
+	rn.runDue(context.Background())
+	for _, rcpt := range repo.rcpts {
+		if rcpt.Status != RecipientSent {
+			t.Errorf("recipient %s is %s, want %s", rcpt.Number, rcpt.Status, RecipientSent)
+		}
+	}
+}
+
+func TestRunnerFailsRefusedRecipients(t *testing.T) {
+	refused := pkg.WithStatus(http.StatusUnprocessableEntity, errors.New("from parameter not found"))
+	rn, repo := newTestRunner(fakeLimiter{ok: true}, fakeOutbound{refused: map[string]error{"+15550000002": refused}}, "+15550000002")
+
+	rn.runDue(context.Background())
+
+	if len(repo.finished) != 1 || repo.finished[0].Status != RecipientFailed {
+		t.Fatalf("finished %+v, want the recipient failed", repo.finished)
+	}
+}
+
+func TestRunnerDefersCappedCountries(t *testing.T) {
+	capped := pkg.WithCode(http.StatusTooManyRequests, destinations.CodeDailyCapReached,
+		errors.New("daily cap of 1 messages to GB reached"))
+	outbound := fakeOutbound{refused: map[string]error{"+447700900001": capped}}
+	rn, repo := newTestRunner(fakeLimiter{ok: true}, outbound, "+447700900001", "+447700900002", "+15550000002")
+
+	rn.runDue(context.Background())
+
+	want := map[string]string{
+		"+447700900001": RecipientPending,
+		"+447700900002": RecipientPending,
+		"+15550000002":  RecipientSent,
+	}
+	for _, rcpt := range repo.rcpts {
+		if rcpt.Status != want[rcpt.Number] {
+			t.Errorf("recipient %s is %s, want %s", rcpt.Number, rcpt.Status, want[rcpt.Number])
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package campaigns
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/destinations"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/phone"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// statusCheckEvery is how many messages a runner sends between checks that
+// the campaign has not been paused or cancelled.
+const statusCheckEvery = 10
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	create(ctx context.Context, req CampaignReq, clientIP string) (*Campaign, error)
+	list(ctx context.Context) ([]Campaign, error)
+	find(ctx context.Context, id int64) (*Campaign, error)
+	start(ctx context.Context, id int64) (*Campaign, error)
+	pause(ctx context.Context, id int64) (*Campaign, error)
+	resume(ctx context.Context, id int64) (*Campaign, error)
+	cancel(ctx context.Context, id int64) (*Campaign, error)
+	run(ctx context.Context, c Campaign, allow func(pkg.PostReq) (bool, error)) error
+}
+
+type service struct {
+	repo      Repository
+	outbound  outbounds.Service
+	templates outbounds.TemplateRenderer
+	groups    outbounds.GroupMembers
+}
+
+func NewService(repo Repository, outbound outbounds.Service, templates outbounds.TemplateRenderer, groups outbounds.GroupMembers) Service {
+	svc := &service{
+		repo:      repo,
+		outbound:  outbound,
+		templates: templates,
+		groups:    groups,
+	}
+	return svc
+}
+
+func notFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no campaign with id %d", id))
+}
+
+// create stores a draft campaign once its senders, template and group are
+// known to belong to the account.
+func (s service) create(ctx context.Context, req CampaignReq, clientIP string) (*Campaign, error) {
+	accountId := pkg.AccountID(ctx)
+
+	owned, err := s.repo.ownedNumbers(ctx, accountId, req.Senders)
+	if err != nil {
+		return nil, err
+	}
+	for _, from := range req.Senders {
+		if !owned[from] {
+			return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.Errorf("sender %s not found", from))
+		}
+	}
+
+	if req.TemplateID != nil {
+		if _, _, err := s.templates.Render(ctx, accountId, *req.TemplateID, req.Variables); err != nil {
+			return nil, err
+		}
+	}
+	if req.GroupID != nil {
+		if _, err := s.groups.Members(ctx, accountId, *req.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.create(ctx, accountId, req, clientIP)
+}
+
+func (s service) list(ctx context.Context) ([]Campaign, error) {
+	return s.repo.list(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) find(ctx context.Context, id int64) (*Campaign, error) {
+	c, err := s.repo.find(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, notFound(id)
+	}
+	return c, nil
+}
+
+// start resolves the audience of a draft campaign and sets it running. A
+// group audience is read now, so later changes to the group do not affect
+// the campaign.
+func (s service) start(ctx context.Context, id int64) (*Campaign, error) {
+	c, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != StatusDraft {
+		return nil, pkg.WithStatus(http.StatusConflict, errors.Errorf("campaign is %s", c.Status))
+	}
+
+	numbers := []string(c.To)
+	if len(numbers) == 0 {
+		if c.GroupID == nil {
+			return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.New("the campaign's group was deleted"))
+		}
+		if numbers, err = s.groups.Members(ctx, c.AccountID, *c.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.New("the campaign's audience is empty"))
+	}
+
+	ok, err := s.repo.start(ctx, id, c.AccountID, numbers)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, pkg.WithStatus(http.StatusConflict, errors.New("campaign is no longer a draft"))
+	}
+	return s.find(ctx, id)
+}
+
+func (s service) pause(ctx context.Context, id int64) (*Campaign, error) {
+	return s.transition(ctx, id, []string{StatusRunning}, StatusPaused)
+}
+
+func (s service) resume(ctx context.Context, id int64) (*Campaign, error) {
+	return s.transition(ctx, id, []string{StatusPaused}, StatusRunning)
+}
+
+func (s service) cancel(ctx context.Context, id int64) (*Campaign, error) {
+	return s.transition(ctx, id, []string{StatusDraft, StatusRunning, StatusPaused}, StatusCancelled)
+}
+
+func (s service) transition(ctx context.Context, id int64, from []string, to string) (*Campaign, error) {
+	ok, err := s.repo.transition(ctx, id, pkg.AccountID(ctx), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, pkg.WithStatus(http.StatusConflict, errors.Errorf("campaign is %s", c.Status))
+	}
+	return c, nil
+}
+
+// run sends the share of a running campaign that its rate allows since it
+// last ran. Recipients are spread over the senders in turn, and a sender
+// that reaches its rate limit is left out until the next run; when all of
+// them have, the campaign waits for their limits to reset.
+func (s service) run(ctx context.Context, c Campaign, allow func(pkg.PostReq) (bool, error)) (err error) {
+	ctx, span := pkg.StartSpan(ctx, "campaigns.service.run",
+		pkg.AttrAccountID.Int64(c.AccountID),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	log := pkg.Logger(ctx).WithField("campaign_id", c.ID)
+
+	budget := c.RatePerMinute
+	if c.LastRunAt != nil {
+		// a campaign that was paused or waited on its limits does not catch up
+		if n := int(float64(c.RatePerMinute) * time.Since(*c.LastRunAt).Minutes()); n < budget {
+			budget = n
+		}
+	}
+	if budget < 1 {
+		return s.repo.release(ctx, c.ID, false)
+	}
+
+	rcpts, err := s.repo.pending(ctx, c.ID, budget)
+	if err != nil {
+		s.repo.release(ctx, c.ID, false)
+		return err
+	}
+
+	err = s.send(ctx, c, rcpts, allow)
+	if err := s.repo.release(ctx, c.ID, true); err != nil {
+		log.WithError(err).Error("unable to release campaign")
+	}
+	if err != nil {
+		return err
+	}
+
+	done, err := s.repo.complete(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if done {
+		log.Info("campaign completed")
+	}
+	return nil
+}
+
+// send sends to rcpts until every sender has reached its limit. A refusal
+// of the message fails its recipient, while any other error, a limiter or
+// store that is unavailable included, ends the run and leaves the
+// recipient to be retried. Recipients in a country whose daily cap is
+// reached are left pending too, to be sent once the cap resets.
+func (s service) send(ctx context.Context, c Campaign, rcpts []Recipient, allow func(pkg.PostReq) (bool, error)) error {
+	senders := c.Senders
+	offset := rand.Intn(len(senders))
+	limited := map[string]bool{}
+	capped := map[string]bool{}
+
+	for i, rcpt := range rcpts {
+		if i > 0 && i%statusCheckEvery == 0 {
+			current, err := s.repo.find(ctx, c.ID, c.AccountID)
+			if err != nil {
+				return err
+			}
+			if current == nil || current.Status != StatusRunning {
+				return nil
+			}
+		}
+
+		if capped[phone.Country(rcpt.Number)] {
+			continue
+		}
+
+		handled := false
+		for j := 0; j < len(senders) && !handled; j++ {
+			from := senders[(offset+i+j)%len(senders)]
+			if limited[from] {
+				continue
+			}
+
+			req := pkg.PostReq{From: from, To: rcpt.Number, Text: c.Text, TemplateID: c.TemplateID, Variables: c.Variables}
+			msg, err := s.outbound.Send(ctx, c.AccountID, req, allow)
+
+			var se *pkg.StatusError
+			switch {
+			case err == outbounds.ErrLimited:
+				limited[from] = true
+				continue
+			case err == outbounds.ErrStopped:
+				rcpt.Status = RecipientSkipped
+			case errors.As(err, &se) && se.Code == destinations.CodeDailyCapReached:
+				// the cap is the country's, so no other sender would do
+				capped[phone.Country(rcpt.Number)] = true
+				handled = true
+				continue
+			case errors.As(err, &se) && se.Status < http.StatusInternalServerError:
+				rcpt.Status = RecipientFailed
+			case err != nil:
+				return err
+			default:
+				rcpt.Status = RecipientSent
+				rcpt.MessageID = &msg.ID
+			}
+
+			rcpt.From = &from
+			if err != nil {
+				reason := err.Error()
+				rcpt.Error = &reason
+			}
+			if err := s.repo.finishRecipient(ctx, rcpt); err != nil {
+				return err
+			}
+			handled = true
+		}
+
+		if !handled {
+			pkg.Logger(ctx).WithField("campaign_id", c.ID).Info("every campaign sender reached its limit")
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package contacts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// importRow is a contact read from a CSV file with the row it came from.
+type importRow struct {
+	row int
+	req ContactReq
+}
+
+// parseCSV reads contacts from a CSV file whose header names the columns.
+// A number column is required, name is optional and every other column is
+// a custom attribute; empty attribute cells are left out. Rows that fail
+// validation are reported rather than failing the whole file.
+func parseCSV(r io.Reader) ([]importRow, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("csv file is empty")
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read csv header")
+	}
+
+	numberCol, nameCol := -1, -1
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+		switch header[i] {
+		case "number":
+			numberCol = i
+		case "name":
+			nameCol = i
+		}
+	}
+	if numberCol < 0 {
+		return nil, nil, errors.New("csv header has no number column")
+	}
+
+	var rows []importRow
+	var rowErrs []RowError
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		// malformed rows count too, so a file of them cannot grow rowErrs
+		// without bound
+		if len(rows)+len(rowErrs) >= MaxImportRows {
+			return nil, nil, errors.Errorf("a csv import may hold at most %d rows", MaxImportRows)
+		}
+		if pe, ok := err.(*csv.ParseError); ok {
+			rowErrs = append(rowErrs, RowError{Row: pe.StartLine, Error: pe.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "read csv")
+		}
+		// quoted fields may span lines, so rows are counted by where they start
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(header) {
+			rowErrs = append(rowErrs, RowError{Row: line, Error: "wrong number of fields"})
+			continue
+		}
+
+		req := ContactReq{Number: record[numberCol], Attributes: Attributes{}}
+		if nameCol >= 0 {
+			req.Name = strings.TrimSpace(record[nameCol])
+		}
+		for i, v := range record {
+			if i != numberCol && i != nameCol && v != "" {
+				req.Attributes[header[i]] = v
+			}
+		}
+		if err := req.Validate(); err != nil {
+			rowErrs = append(rowErrs, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{row: line, req: req})
+	}
+	return rows, rowErrs, nil
+}
+
+// exporter writes contacts in one of the export formats.
+type exporter interface {
+	write(c Contact) error
+	flush() error
+}
+
+// csvExporter writes number, name and one column per attribute key, so an
+// export can be imported again as is.
+type csvExporter struct {
+	w    *csv.Writer
+	keys []string
+}
+
+func newCSVExporter(w io.Writer, keys []string) (*csvExporter, error) {
+	e := &csvExporter{w: csv.NewWriter(w), keys: keys}
+	return e, e.w.Write(append([]string{"number", "name"}, keys...))
+}
+
+func (e *csvExporter) write(c Contact) error {
+	record := make([]string, 0, len(e.keys)+2)
+	record = append(record, c.Number, c.Name)
+	for _, k := range e.keys {
+		record = append(record, c.Attributes[k])
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExporter writes one JSON contact per line.
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e ndjsonExporter) write(c Contact) error {
+	return e.enc.Encode(c)
+}
+
+func (e ndjsonExporter) flush() error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package contacts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	in := "Number, Name ,plan,city\n" +
+		"+15550000002,Ada,gold,\n" +
+		"+15550000003,,,Lagos\n" +
+		"+15550000004,Bob\n" +
+		"call me,Eve,,\n" +
+		"+15550000006,Bo\"b,,\n" +
+		"+15550000007,\"Grace\nHopper\",,\n"
+
+	rows, rowErrs, err := parseCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []importRow{
+		{row: 2, req: ContactReq{Number: "15550000002", Name: "Ada", Attributes: Attributes{"plan": "gold"}}},
+		{row: 3, req: ContactReq{Number: "15550000003", Attributes: Attributes{"city": "Lagos"}}},
+		{row: 7, req: ContactReq{Number: "15550000007", Name: "Grace\nHopper", Attributes: Attributes{}}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+
+	var got []int
+	for _, re := range rowErrs {
+		got = append(got, re.Row)
+	}
+	if !reflect.DeepEqual(got, []int{4, 5, 6}) {
+		t.Errorf("errors on rows %v (%+v), want 4, 5 and 6", got, rowErrs)
+	}
+}
+
+func TestParseCSVHeader(t *testing.T) {
+	for _, in := range []string{"", "name,plan\n+15550000002,Ada\n"} {
+		if _, _, err := parseCSV(strings.NewReader(in)); err == nil {
+			t.Errorf("parseCSV(%q) did not fail", in)
+		}
+	}
+}
+
+func TestParseCSVCapsRows(t *testing.T) {
+	tests := []struct {
+		name string
+		row  string
+	}{
+		{"valid rows", "+15550000002,Ada\n"},
+		{"invalid rows", "not a number,Ada\n"},
+		{"malformed rows", "+15550000002,Bo\"b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := "number,name\n" + strings.Repeat(tt.row, MaxImportRows)
+			rows, rowErrs, err := parseCSV(strings.NewReader(in))
+			if err != nil {
+				t.Fatalf("%d rows: %v", MaxImportRows, err)
+			}
+			if n := len(rows) + len(rowErrs); n != MaxImportRows {
+				t.Fatalf("read %d rows, want %d", n, MaxImportRows)
+			}
+
+			_, _, err = parseCSV(strings.NewReader(in + tt.row))
+			if err == nil {
+				t.Errorf("%d rows were not refused", MaxImportRows+1)
+			}
+		})
+	}
+}
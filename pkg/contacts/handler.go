@@ -0,0 +1,232 @@
+package contacts
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// maxImportBytes bounds the size of an uploaded CSV file.
+const maxImportBytes = 5 << 20
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func urlID(r *http.Request, param, what string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.Errorf("invalid %s id", what))
+	}
+	return id, nil
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req ContactReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	c, err := h.svc.create(r.Context(), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, c)
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	contacts, err := h.svc.list(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, contacts)
+}
+
+func (h Handler) update(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "contact")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req ContactReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	c, err := h.svc.update(r.Context(), id, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, c)
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "contact")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.delete(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "contact deleted")
+}
+
+// importCSV takes the file either as the request body, sent as text/csv,
+// or as the "file" field of a multipart form.
+func (h Handler) importCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var file io.Reader = r.Body
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.Wrap(err, "read file field")))
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	report, err := h.svc.importCSV(r.Context(), file)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, report)
+}
+
+// export streams the contacts as CSV, or as NDJSON with ?format=ndjson.
+func (h Handler) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+
+	switch format {
+	case FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.Errorf("unknown export format %q", format)))
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="contacts.`+format+`"`)
+
+	// the status is sent with the first row, so a failure past that point
+	// can only cut the file short
+	if err := h.svc.export(r.Context(), w, format); err != nil {
+		pkg.Logger(r.Context()).WithError(err).Error("contact export failed")
+	}
+}
+
+func (h Handler) createGroup(w http.ResponseWriter, r *http.Request) {
+	var req GroupReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	g, err := h.svc.createGroup(r.Context(), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, g)
+}
+
+func (h Handler) listGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.svc.listGroups(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, groups)
+}
+
+func (h Handler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "group")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.deleteGroup(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "group deleted")
+}
+
+func (h Handler) listMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "group")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	contacts, err := h.svc.listMembers(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, contacts)
+}
+
+func (h Handler) addMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "group")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req MembersReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	g, err := h.svc.addMembers(r.Context(), id, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, g)
+}
+
+func (h Handler) removeMember(w http.ResponseWriter, r *http.Request) {
+	id, err := urlID(r, "id", "group")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	contactId, err := urlID(r, "contactId", "contact")
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.removeMember(r.Context(), id, contactId); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "contact removed from group")
+}
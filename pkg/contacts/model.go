@@ -0,0 +1,191 @@
+package contacts
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxImportRows bounds the rows of a single CSV import.
+	MaxImportRows = 10000
+	// MaxGroupSize bounds the members of a group, and so the messages a
+	// single group send fans out to.
+	MaxGroupSize = 1000
+	// maxAttributes bounds the custom attributes of a contact.
+	maxAttributes = 32
+)
+
+// e164 matches an E.164 number, with or without its leading +.
+var e164 = regexp.MustCompile(`^\+?[1-9][0-9]{5,14}$`)
+
+// NormalizeNumber checks number is in E.164 form and returns it without the
+// leading +, the way numbers are sent and stored across the API.
+func NormalizeNumber(number string) (string, error) {
+	number = strings.TrimSpace(number)
+	if !e164.MatchString(number) {
+		return "", errors.Errorf("%q is not an E.164 number", number)
+	}
+	return strings.TrimPrefix(number, "+"), nil
+}
+
+// Attributes are the custom attributes of a contact, kept as JSONB.
+type Attributes map[string]string
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *Attributes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case nil:
+		*a = Attributes{}
+		return nil
+	}
+	return errors.Errorf("cannot scan %T into attributes", src)
+}
+
+// Tags are the tags set on a contact by auto-reply rules, kept as JSONB.
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(t)
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case nil:
+		*t = Tags{}
+		return nil
+	}
+	return errors.Errorf("cannot scan %T into tags", src)
+}
+
+// Contact is a number an account sends to, with a name and custom
+// attributes.
+type Contact struct {
+	ID         int64      `json:"id" db:"id"`
+	AccountID  int64      `json:"-" db:"account_id"`
+	Number     string     `json:"number" db:"number"`
+	Name       string     `json:"name" db:"name"`
+	Attributes Attributes `json:"attributes" db:"attributes"`
+	Tags       Tags       `json:"tags" db:"tags"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ContactReq creates or updates a contact.
+type ContactReq struct {
+	Number     string     `json:"number"`
+	Name       string     `json:"name"`
+	Attributes Attributes `json:"attributes"`
+}
+
+func (v *ContactReq) Bind(r *http.Request) error {
+	return v.Validate()
+}
+
+// Validate checks the contact and normalises its number. CSV rows go
+// through it too.
+func (v *ContactReq) Validate() error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "number", Field: v.Number, Message: fmt.Sprintf("%s is missing", "number")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Min: 0, Max: 128, Message: fmt.Sprintf("%s is invalid", "name")},
+	)
+	if v.Number != "" {
+		number, err := NormalizeNumber(v.Number)
+		if err != nil {
+			err1.Add("number", err.Error())
+		}
+		v.Number = number
+	}
+	if len(v.Attributes) > maxAttributes {
+		err1.Add("attributes", fmt.Sprintf("a contact may have at most %d attributes", maxAttributes))
+	}
+	for k := range v.Attributes {
+		if k == "" || k == "number" || k == "name" {
+			err1.Add("attributes", fmt.Sprintf("%q is not a valid attribute name", k))
+		}
+	}
+	if v.Attributes == nil {
+		v.Attributes = Attributes{}
+	}
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+// Group is a named set of an account's contacts.
+type Group struct {
+	ID        int64     `json:"id" db:"id"`
+	AccountID int64     `json:"-" db:"account_id"`
+	Name      string    `json:"name" db:"name"`
+	Size      int       `json:"size" db:"size"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// GroupReq creates a group.
+type GroupReq struct {
+	Name string `json:"name"`
+}
+
+func (v *GroupReq) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%s is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Min: 1, Max: 64, Message: fmt.Sprintf("%s is invalid", "name")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+// MembersReq adds contacts to a group.
+type MembersReq struct {
+	ContactIDs []int64 `json:"contact_ids"`
+}
+
+func (v *MembersReq) Bind(r *http.Request) error {
+	switch {
+	case len(v.ContactIDs) == 0:
+		return errors.New("contact_ids is missing")
+	case len(v.ContactIDs) > MaxGroupSize:
+		return errors.Errorf("a group may hold at most %d contacts", MaxGroupSize)
+	}
+	return nil
+}
+
+// RowError reports why a CSV row was not imported. Rows are numbered from
+// 1, the header included, as a spreadsheet shows them.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportReport is the outcome of a CSV import.
+type ImportReport struct {
+	Imported int        `json:"imported"`
+	Errors   []RowError `json:"errors"`
+}
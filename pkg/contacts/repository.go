@@ -0,0 +1,259 @@
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	create(ctx context.Context, accountId int64, req ContactReq) (*Contact, error)
+	list(ctx context.Context, accountId int64) ([]Contact, error)
+	update(ctx context.Context, id, accountId int64, req ContactReq) (*Contact, error)
+	delete(ctx context.Context, id, accountId int64) (bool, error)
+	upsert(ctx context.Context, accountId int64, reqs []ContactReq) error
+	attributeKeys(ctx context.Context, accountId int64) ([]string, error)
+	each(ctx context.Context, accountId int64, fn func(Contact) error) error
+
+	createGroup(ctx context.Context, accountId int64, req GroupReq) (*Group, error)
+	listGroups(ctx context.Context, accountId int64) ([]Group, error)
+	findGroup(ctx context.Context, id, accountId int64) (*Group, error)
+	deleteGroup(ctx context.Context, id, accountId int64) (bool, error)
+	addMembers(ctx context.Context, groupId, accountId int64, contactIds []int64) (int, error)
+	removeMember(ctx context.Context, groupId, contactId, accountId int64) (bool, error)
+	members(ctx context.Context, groupId, accountId int64) ([]Contact, error)
+	tag(ctx context.Context, accountId int64, number, tag string) error
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+// errDuplicate is returned when the account already has a contact with the
+// number.
+var errDuplicate = errors.New("duplicate contact number")
+
+// isUniqueViolation reports whether err is a postgres unique_violation,
+// whichever driver reported it.
+func isUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == "23505"
+}
+
+func (r repository) create(ctx context.Context, accountId int64, req ContactReq) (*Contact, error) {
+	var c Contact
+	err := r.db.GetContext(ctx, &c, `INSERT INTO contact (account_id, number, name, attributes)
+		VALUES ($1, $2, $3, $4) RETURNING *`, accountId, req.Number, req.Name, req.Attributes)
+	if isUniqueViolation(err) {
+		return nil, errDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r repository) list(ctx context.Context, accountId int64) ([]Contact, error) {
+	contacts := []Contact{}
+	err := r.db.SelectContext(ctx, &contacts, `SELECT * FROM contact WHERE account_id = $1 ORDER BY id`, accountId)
+	return contacts, err
+}
+
+// update returns nil when the account has no such contact.
+func (r repository) update(ctx context.Context, id, accountId int64, req ContactReq) (*Contact, error) {
+	var c Contact
+	err := r.db.GetContext(ctx, &c, `UPDATE contact SET number = $1, name = $2, attributes = $3, updated_at = now()
+		WHERE id = $4 AND account_id = $5 RETURNING *`, req.Number, req.Name, req.Attributes, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if isUniqueViolation(err) {
+		return nil, errDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r repository) delete(ctx context.Context, id, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM contact WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// upsert creates the contacts, replacing the name and attributes of those
+// whose number the account already has. Either all are stored or none.
+func (r repository) upsert(ctx context.Context, accountId int64, reqs []ContactReq) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, `INSERT INTO contact (account_id, number, name, attributes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, number) DO UPDATE
+		SET name = EXCLUDED.name, attributes = EXCLUDED.attributes, updated_at = now()`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, req := range reqs {
+		if _, err := stmt.ExecContext(ctx, accountId, req.Number, req.Name, req.Attributes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// attributeKeys returns every attribute name used by the account's
+// contacts, sorted.
+func (r repository) attributeKeys(ctx context.Context, accountId int64) ([]string, error) {
+	var keys []string
+	err := r.db.SelectContext(ctx, &keys, `SELECT DISTINCT jsonb_object_keys(attributes) AS key
+		FROM contact WHERE account_id = $1 ORDER BY key`, accountId)
+	return keys, err
+}
+
+// each calls fn for every contact of the account without loading them all
+// at once, stopping at the first error.
+func (r repository) each(ctx context.Context, accountId int64, fn func(Contact) error) error {
+	rows, err := r.db.QueryxContext(ctx, `SELECT * FROM contact WHERE account_id = $1 ORDER BY id`, accountId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Contact
+		if err := rows.StructScan(&c); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const selectGroup = `SELECT g.id, g.account_id, g.name, g.created_at,
+	(SELECT count(*) FROM contact_group_member m WHERE m.group_id = g.id) AS size
+	FROM contact_group g`
+
+func (r repository) createGroup(ctx context.Context, accountId int64, req GroupReq) (*Group, error) {
+	var g Group
+	err := r.db.GetContext(ctx, &g, `INSERT INTO contact_group (account_id, name)
+		VALUES ($1, $2) RETURNING *`, accountId, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r repository) listGroups(ctx context.Context, accountId int64) ([]Group, error) {
+	groups := []Group{}
+	err := r.db.SelectContext(ctx, &groups, selectGroup+` WHERE g.account_id = $1 ORDER BY g.id`, accountId)
+	return groups, err
+}
+
+// findGroup returns nil when the account has no such group.
+func (r repository) findGroup(ctx context.Context, id, accountId int64) (*Group, error) {
+	var g Group
+	err := r.db.GetContext(ctx, &g, selectGroup+` WHERE g.id = $1 AND g.account_id = $2`, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// deleteGroup removes the group but not its contacts.
+func (r repository) deleteGroup(ctx context.Context, id, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM contact_group WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// addMembers adds the account's contacts among contactIds to the group,
+// which must be the account's, and returns the group size. Ids of other
+// accounts' contacts are ignored. Nothing is added if the group would grow
+// past MaxGroupSize, and -1 is returned.
+func (r repository) addMembers(ctx context.Context, groupId, accountId int64, contactIds []int64) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query, args, err := sqlx.In(`INSERT INTO contact_group_member (group_id, contact_id)
+		SELECT g.id, c.id FROM contact_group g JOIN contact c ON c.account_id = g.account_id
+		WHERE g.id = ? AND g.account_id = ? AND c.id IN (?)
+		ON CONFLICT DO NOTHING`, groupId, accountId, contactIds)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+
+	var size int
+	err = tx.GetContext(ctx, &size, `SELECT count(*) FROM contact_group_member WHERE group_id = $1`, groupId)
+	if err != nil {
+		return 0, err
+	}
+	if size > MaxGroupSize {
+		return -1, nil
+	}
+	return size, tx.Commit()
+}
+
+func (r repository) removeMember(ctx context.Context, groupId, contactId, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM contact_group_member m USING contact_group g
+		WHERE m.group_id = g.id AND g.id = $1 AND g.account_id = $2 AND m.contact_id = $3`, groupId, accountId, contactId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r repository) members(ctx context.Context, groupId, accountId int64) ([]Contact, error) {
+	contacts := []Contact{}
+	err := r.db.SelectContext(ctx, &contacts, `SELECT c.* FROM contact c
+		JOIN contact_group_member m ON m.contact_id = c.id
+		JOIN contact_group g ON g.id = m.group_id
+		WHERE g.id = $1 AND g.account_id = $2 ORDER BY c.id`, groupId, accountId)
+	return contacts, err
+}
+
+// tag adds tag to the contact with number, creating the contact if the
+// account has none yet.
+func (r repository) tag(ctx context.Context, accountId int64, number, tag string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO contact (account_id, number, tags)
+		VALUES ($1, $2, jsonb_build_array($3::text))
+		ON CONFLICT (account_id, number) DO UPDATE
+		SET tags = CASE WHEN jsonb_exists(contact.tags, $3) THEN contact.tags ELSE contact.tags || jsonb_build_array($3::text) END,
+			updated_at = now()`, accountId, number, tag)
+	return err
+}
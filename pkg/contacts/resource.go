@@ -0,0 +1,44 @@
+package contacts
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db, rs.rd)
+	svc := NewService(repo)
+	hndlr := NewHandler(svc)
+
+	r.Get("/", hndlr.list)
+	r.Post("/", hndlr.create)
+	r.Post("/import", hndlr.importCSV)
+	r.Get("/export", hndlr.export)
+	r.Put("/{id}", hndlr.update)
+	r.Delete("/{id}", hndlr.delete)
+
+	r.Get("/groups", hndlr.listGroups)
+	r.Post("/groups", hndlr.createGroup)
+	r.Delete("/groups/{id}", hndlr.deleteGroup)
+	r.Get("/groups/{id}/members", hndlr.listMembers)
+	r.Post("/groups/{id}/members", hndlr.addMembers)
+	r.Delete("/groups/{id}/members/{contactId}", hndlr.removeMember)
+
+	return r
+}
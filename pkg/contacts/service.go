@@ -0,0 +1,239 @@
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+)
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	create(ctx context.Context, req ContactReq) (*Contact, error)
+	list(ctx context.Context) ([]Contact, error)
+	update(ctx context.Context, id int64, req ContactReq) (*Contact, error)
+	delete(ctx context.Context, id int64) error
+	importCSV(ctx context.Context, r io.Reader) (*ImportReport, error)
+	export(ctx context.Context, w io.Writer, format string) error
+
+	createGroup(ctx context.Context, req GroupReq) (*Group, error)
+	listGroups(ctx context.Context) ([]Group, error)
+	deleteGroup(ctx context.Context, id int64) error
+	addMembers(ctx context.Context, groupId int64, req MembersReq) (*Group, error)
+	removeMember(ctx context.Context, groupId, contactId int64) error
+	listMembers(ctx context.Context, groupId int64) ([]Contact, error)
+	// Members returns the numbers of every contact in an account's group.
+	Members(ctx context.Context, accountId, groupId int64) ([]string, error)
+	// Tag tags the account's contact with number, creating it if needed.
+	Tag(ctx context.Context, accountId int64, number, tag string) error
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+func contactNotFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no contact with id %d", id))
+}
+
+func groupNotFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no group with id %d", id))
+}
+
+func duplicate(number string) error {
+	return pkg.WithStatus(http.StatusConflict, errors.Errorf("a contact with number %s already exists", number))
+}
+
+func (s service) create(ctx context.Context, req ContactReq) (*Contact, error) {
+	c, err := s.repo.create(ctx, pkg.AccountID(ctx), req)
+	if err == errDuplicate {
+		return nil, duplicate(req.Number)
+	}
+	return c, err
+}
+
+func (s service) list(ctx context.Context) ([]Contact, error) {
+	return s.repo.list(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) update(ctx context.Context, id int64, req ContactReq) (*Contact, error) {
+	c, err := s.repo.update(ctx, id, pkg.AccountID(ctx), req)
+	if err == errDuplicate {
+		return nil, duplicate(req.Number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, contactNotFound(id)
+	}
+	return c, nil
+}
+
+func (s service) delete(ctx context.Context, id int64) error {
+	ok, err := s.repo.delete(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return contactNotFound(id)
+	}
+	return nil
+}
+
+// importCSV stores every valid row of the file and reports the others. A
+// file that cannot be read as CSV at all is rejected with 400.
+func (s service) importCSV(ctx context.Context, r io.Reader) (report *ImportReport, err error) {
+	accountId := pkg.AccountID(ctx)
+
+	ctx, span := pkg.StartSpan(ctx, "contacts.service.importCSV",
+		pkg.AttrAccountID.Int64(accountId),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	rows, rowErrs, err := parseCSV(r)
+	if err != nil {
+		return nil, pkg.WithStatus(http.StatusBadRequest, err)
+	}
+
+	reqs := make([]ContactReq, len(rows))
+	for i, row := range rows {
+		reqs[i] = row.req
+	}
+	if len(reqs) > 0 {
+		if err := s.repo.upsert(ctx, accountId, reqs); err != nil {
+			return nil, err
+		}
+	}
+
+	if rowErrs == nil {
+		rowErrs = []RowError{}
+	}
+	return &ImportReport{Imported: len(reqs), Errors: rowErrs}, nil
+}
+
+// export writes every contact of the account to w in format.
+func (s service) export(ctx context.Context, w io.Writer, format string) error {
+	accountId := pkg.AccountID(ctx)
+
+	var e exporter
+	switch format {
+	case FormatCSV:
+		keys, err := s.repo.attributeKeys(ctx, accountId)
+		if err != nil {
+			return err
+		}
+		if e, err = newCSVExporter(w, keys); err != nil {
+			return err
+		}
+	case FormatNDJSON:
+		e = ndjsonExporter{enc: json.NewEncoder(w)}
+	default:
+		return pkg.WithStatus(http.StatusBadRequest, errors.Errorf("unknown export format %q", format))
+	}
+
+	if err := s.repo.each(ctx, accountId, e.write); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+func (s service) createGroup(ctx context.Context, req GroupReq) (*Group, error) {
+	return s.repo.createGroup(ctx, pkg.AccountID(ctx), req)
+}
+
+func (s service) listGroups(ctx context.Context) ([]Group, error) {
+	return s.repo.listGroups(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) deleteGroup(ctx context.Context, id int64) error {
+	ok, err := s.repo.deleteGroup(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return groupNotFound(id)
+	}
+	return nil
+}
+
+func (s service) addMembers(ctx context.Context, groupId int64, req MembersReq) (*Group, error) {
+	accountId := pkg.AccountID(ctx)
+
+	g, err := s.repo.findGroup(ctx, groupId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, groupNotFound(groupId)
+	}
+
+	size, err := s.repo.addMembers(ctx, groupId, accountId, req.ContactIDs)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.Errorf("a group may hold at most %d contacts", MaxGroupSize))
+	}
+	g.Size = size
+	return g, nil
+}
+
+func (s service) removeMember(ctx context.Context, groupId, contactId int64) error {
+	ok, err := s.repo.removeMember(ctx, groupId, contactId, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.WithStatus(http.StatusNotFound, errors.Errorf("contact %d is not in group %d", contactId, groupId))
+	}
+	return nil
+}
+
+func (s service) listMembers(ctx context.Context, groupId int64) ([]Contact, error) {
+	return s.members(ctx, pkg.AccountID(ctx), groupId)
+}
+
+func (s service) members(ctx context.Context, accountId, groupId int64) ([]Contact, error) {
+	g, err := s.repo.findGroup(ctx, groupId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, groupNotFound(groupId)
+	}
+	return s.repo.members(ctx, groupId, accountId)
+}
+
+func (s service) Members(ctx context.Context, accountId, groupId int64) ([]string, error) {
+	contacts, err := s.members(ctx, accountId, groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]string, len(contacts))
+	for i, c := range contacts {
+		numbers[i] = c.Number
+	}
+	return numbers, nil
+}
+
+func (s service) Tag(ctx context.Context, accountId int64, number, tag string) error {
+	return s.repo.tag(ctx, accountId, number, tag)
+}
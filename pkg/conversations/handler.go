@@ -0,0 +1,88 @@
+package conversations
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func conversationID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid conversation id"))
+	}
+	return id, nil
+}
+
+// list pages through conversations with ?before=, the last_message_at of
+// the last conversation of the previous page.
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	var before *time.Time
+	if v := r.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("before must be an RFC 3339 time")))
+			return
+		}
+		before = &t
+	}
+
+	convs, err := h.svc.list(r.Context(), before, pageSize(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, convs)
+}
+
+// messages pages through a conversation, newest first, with ?before=, the
+// id of the last message of the previous page.
+func (h Handler) messages(w http.ResponseWriter, r *http.Request) {
+	id, err := conversationID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var before *int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		b, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("before must be a message id")))
+			return
+		}
+		before = &b
+	}
+
+	msgs, err := h.svc.messages(r.Context(), id, before, pageSize(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, msgs)
+}
+
+func (h Handler) markRead(w http.ResponseWriter, r *http.Request) {
+	id, err := conversationID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.markRead(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "conversation marked read")
+}
@@ -0,0 +1,57 @@
+package conversations
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Message directions.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Message is a message of a conversation, in either direction.
+type Message struct {
+	ID        int64      `json:"id" db:"id"`
+	Direction string     `json:"direction" db:"direction"`
+	From      string     `json:"from" db:"from_number"`
+	To        string     `json:"to" db:"to_number"`
+	Text      string     `json:"text" db:"text"`
+	Status    string     `json:"status" db:"status"`
+	SendAt    *time.Time `json:"send_at,omitempty" db:"send_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Conversation is the thread between one of an account's numbers and a
+// remote number.
+type Conversation struct {
+	ID            int64     `json:"id" db:"id"`
+	AccountID     int64     `json:"-" db:"account_id"`
+	AccountNumber string    `json:"account_number" db:"account_number"`
+	RemoteNumber  string    `json:"remote_number" db:"remote_number"`
+	Unread        int       `json:"unread" db:"unread"`
+	LastMessageAt time.Time `json:"last_message_at" db:"last_message_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	LastMessage   *Message  `json:"last_message,omitempty" db:"-"`
+}
+
+// pageSize reads ?limit= from r, falling back to the default when it is
+// missing or not a positive number.
+func pageSize(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	switch {
+	case err != nil || limit <= 0:
+		return defaultPageSize
+	case limit > maxPageSize:
+		return maxPageSize
+	}
+	return limit
+}
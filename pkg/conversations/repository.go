@@ -0,0 +1,117 @@
+package conversations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	// Attach returns the conversation between accountNumber and
+	// remoteNumber, creating it on its first message, and records that a
+	// message in direction was just added to it.
+	Attach(ctx context.Context, accountId int64, accountNumber, remoteNumber, direction string) (int64, error)
+	list(ctx context.Context, accountId int64, before *time.Time, limit int) ([]Conversation, error)
+	lastMessages(ctx context.Context, ids []int64) (map[int64]Message, error)
+	find(ctx context.Context, id, accountId int64) (*Conversation, error)
+	messages(ctx context.Context, id int64, before *int64, limit int) ([]Message, error)
+	markRead(ctx context.Context, id, accountId int64) (bool, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+func (r repository) Attach(ctx context.Context, accountId int64, accountNumber, remoteNumber, direction string) (int64, error) {
+	unread := 0
+	if direction == DirectionInbound {
+		unread = 1
+	}
+
+	var id int64
+	err := r.db.GetContext(ctx, &id, `INSERT INTO conversation (account_id, account_number, remote_number, unread)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, account_number, remote_number) DO UPDATE
+		SET unread = conversation.unread + EXCLUDED.unread, last_message_at = now()
+		RETURNING id`, accountId, accountNumber, remoteNumber, unread)
+	return id, err
+}
+
+func (r repository) list(ctx context.Context, accountId int64, before *time.Time, limit int) ([]Conversation, error) {
+	convs := []Conversation{}
+	err := r.db.SelectContext(ctx, &convs, `SELECT * FROM conversation
+		WHERE account_id = $1 AND ($2::timestamptz IS NULL OR last_message_at < $2)
+		ORDER BY last_message_at DESC LIMIT $3`, accountId, before, limit)
+	return convs, err
+}
+
+// lastMessages returns the latest message of each conversation in ids.
+func (r repository) lastMessages(ctx context.Context, ids []int64) (map[int64]Message, error) {
+	last := make(map[int64]Message, len(ids))
+	if len(ids) == 0 {
+		return last, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT DISTINCT ON (conversation_id) conversation_id, id, direction, from_number, to_number, text, status, send_at, sent_at, created_at
+		FROM message WHERE conversation_id IN (?)
+		ORDER BY conversation_id, id DESC`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ConversationID int64 `db:"conversation_id"`
+		Message
+	}
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		last[row.ConversationID] = row.Message
+	}
+	return last, nil
+}
+
+// find returns nil when the account has no such conversation.
+func (r repository) find(ctx context.Context, id, accountId int64) (*Conversation, error) {
+	var c Conversation
+	err := r.db.GetContext(ctx, &c, `SELECT * FROM conversation WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// messages returns up to limit messages of the conversation older than the
+// message before, newest first.
+func (r repository) messages(ctx context.Context, id int64, before *int64, limit int) ([]Message, error) {
+	msgs := []Message{}
+	err := r.db.SelectContext(ctx, &msgs, `SELECT id, direction, from_number, to_number, text, status, send_at, sent_at, created_at
+		FROM message
+		WHERE conversation_id = $1 AND ($2::bigint IS NULL OR id < $2)
+		ORDER BY id DESC LIMIT $3`, id, before, limit)
+	return msgs, err
+}
+
+func (r repository) markRead(ctx context.Context, id, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE conversation SET unread = 0 WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,79 @@
+package conversations
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	list(ctx context.Context, before *time.Time, limit int) ([]Conversation, error)
+	messages(ctx context.Context, id int64, before *int64, limit int) ([]Message, error)
+	markRead(ctx context.Context, id int64) error
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+func notFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no conversation with id %d", id))
+}
+
+// list returns the most recently active conversations with their last
+// message.
+func (s service) list(ctx context.Context, before *time.Time, limit int) ([]Conversation, error) {
+	convs, err := s.repo.list(ctx, pkg.AccountID(ctx), before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(convs))
+	for i, c := range convs {
+		ids[i] = c.ID
+	}
+	last, err := s.repo.lastMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range convs {
+		if msg, ok := last[convs[i].ID]; ok {
+			convs[i].LastMessage = &msg
+		}
+	}
+	return convs, nil
+}
+
+func (s service) messages(ctx context.Context, id int64, before *int64, limit int) ([]Message, error) {
+	c, err := s.repo.find(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, notFound(id)
+	}
+	return s.repo.messages(ctx, id, before, limit)
+}
+
+func (s service) markRead(ctx context.Context, id int64) error {
+	ok, err := s.repo.markRead(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound(id)
+	}
+	return nil
+}
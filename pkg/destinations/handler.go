@@ -0,0 +1,115 @@
+package destinations
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func countryParam(r *http.Request) (string, error) {
+	c, ok := country(chi.URLParam(r, "country"))
+	if !ok {
+		return "", pkg.WithStatus(http.StatusBadRequest,
+			errors.New("country must be an ISO 3166-1 alpha-2 code, 001 or *"))
+	}
+	return c, nil
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.svc.list(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, policies)
+}
+
+func (h Handler) put(w http.ResponseWriter, r *http.Request) {
+	c, err := countryParam(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req PolicyReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	p, err := h.svc.put(r.Context(), c, req, middleware2.ClientIP(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, p)
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	c, err := countryParam(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.delete(r.Context(), c, middleware2.ClientIP(r)); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "destination policy deleted")
+}
+
+func (h Handler) listDefaults(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.svc.listDefaults(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, policies)
+}
+
+func (h Handler) putDefault(w http.ResponseWriter, r *http.Request) {
+	c, err := countryParam(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req PolicyReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	p, err := h.svc.putDefault(r.Context(), c, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, p)
+}
+
+func (h Handler) deleteDefault(w http.ResponseWriter, r *http.Request) {
+	c, err := countryParam(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.deleteDefault(r.Context(), c); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "default destination policy deleted")
+}
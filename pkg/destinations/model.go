@@ -0,0 +1,75 @@
+package destinations
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/olusolaa/go-backend/pkg/phone"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Codes of the errors of refused destinations.
+const (
+	CodeCountryDisabled = "destination_country_disabled"
+	CodeDailyCapReached = "destination_daily_cap_reached"
+)
+
+// AnyCountry is the country of policies for every country without a policy
+// of its own.
+const AnyCountry = "*"
+
+// Audit actions.
+const (
+	ActionPut    = "destinations.put"
+	ActionDelete = "destinations.delete"
+)
+
+// Policy says whether messages may be sent to Country and how many a day,
+// for one account or, when Default, for every account without its own.
+type Policy struct {
+	ID        int64  `json:"-" db:"id"`
+	AccountID *int64 `json:"-" db:"account_id"`
+	Country   string `json:"country" db:"country"`
+	Enabled   bool   `json:"enabled" db:"enabled"`
+	// DailyCap is how many messages the account may send to the country
+	// a day, UTC. 0 means there is no cap.
+	DailyCap  int       `json:"daily_cap" db:"daily_cap"`
+	Default   bool      `json:"default" db:"is_default"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// unrestricted is the policy of countries no policy covers.
+var unrestricted = Policy{Country: AnyCountry, Enabled: true}
+
+// PolicyReq sets the policy of a country.
+type PolicyReq struct {
+	Enabled  *bool `json:"enabled"`
+	DailyCap int   `json:"daily_cap"`
+}
+
+func (v *PolicyReq) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.IntIsGreaterThan{Name: "daily_cap", Field: v.DailyCap, Compared: -1, Message: fmt.Sprintf("%s is invalid", "daily_cap")},
+	)
+	if v.Enabled == nil {
+		err1.Add("enabled", fmt.Sprintf("%s is missing", "enabled"))
+	}
+
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+var alpha2 = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// country checks the country of a route: an ISO 3166-1 alpha-2 code,
+// phone.NonGeographic or AnyCountry.
+func country(s string) (string, bool) {
+	s = strings.ToUpper(s)
+	return s, alpha2.MatchString(s) || s == phone.NonGeographic || s == AnyCountry
+}
@@ -0,0 +1,140 @@
+package destinations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg/audit"
+	"time"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+// Repository methods take a nil account for the default policy.
+type Repository interface {
+	list(ctx context.Context, accountId *int64) ([]Policy, error)
+	find(ctx context.Context, accountId int64, country string) (*Policy, error)
+	put(ctx context.Context, accountId *int64, country string, req PolicyReq, clientIP string) (*Policy, error)
+	delete(ctx context.Context, accountId *int64, country, clientIP string) (bool, error)
+	take(ctx context.Context, accountId int64, country string, cap int, now time.Time) (bool, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+func (r repository) list(ctx context.Context, accountId *int64) ([]Policy, error) {
+	policies := []Policy{}
+	err := r.db.SelectContext(ctx, &policies, `SELECT *, account_id IS NULL AS is_default FROM destination_policy
+		WHERE account_id IS NOT DISTINCT FROM $1 ORDER BY country`, accountId)
+	return policies, err
+}
+
+// find returns the policy that applies to messages of the account to
+// country, in the order of precedence of the migration, or nil when none
+// does.
+func (r repository) find(ctx context.Context, accountId int64, country string) (*Policy, error) {
+	var p Policy
+	err := r.db.GetContext(ctx, &p, `SELECT *, account_id IS NULL AS is_default FROM destination_policy
+		WHERE (account_id = $1 OR account_id IS NULL) AND country IN ($2, '*')
+		ORDER BY account_id IS NULL, country = '*' LIMIT 1`, accountId, country)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// put creates or replaces the policy of country. Changes to an account's
+// policy are audited in the same transaction.
+func (r repository) put(ctx context.Context, accountId *int64, country string, req PolicyReq, clientIP string) (*Policy, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var p Policy
+	err = tx.GetContext(ctx, &p, `INSERT INTO destination_policy (account_id, country, enabled, daily_cap)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (COALESCE(account_id, 0), country)
+		DO UPDATE SET enabled = EXCLUDED.enabled, daily_cap = EXCLUDED.daily_cap, updated_at = now()
+		RETURNING *, account_id IS NULL AS is_default`, accountId, country, *req.Enabled, req.DailyCap)
+	if err != nil {
+		return nil, err
+	}
+
+	if accountId != nil {
+		err := audit.Record(ctx, tx, audit.Event{AccountID: *accountId, Action: ActionPut, ClientIP: clientIP,
+			Details: audit.Details{
+				"country":   country,
+				"enabled":   fmt.Sprint(p.Enabled),
+				"daily_cap": fmt.Sprint(p.DailyCap),
+			}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, tx.Commit()
+}
+
+// delete reports whether there was a policy of country to delete. Changes
+// to an account's policy are audited in the same transaction.
+func (r repository) delete(ctx context.Context, accountId *int64, country, clientIP string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM destination_policy
+		WHERE account_id IS NOT DISTINCT FROM $1 AND country = $2`, accountId, country)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if accountId != nil {
+		err := audit.Record(ctx, tx, audit.Event{AccountID: *accountId, Action: ActionDelete, ClientIP: clientIP,
+			Details: audit.Details{"country": country}})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// take counts a message of the account to country against cap for the
+// UTC day of now, reporting false, without counting it, when cap is
+// reached.
+func (r repository) take(ctx context.Context, accountId int64, country string, cap int, now time.Time) (bool, error) {
+	key := fmt.Sprintf("destinations:%d:%s:%s", accountId, country, now.UTC().Format("2006-01-02"))
+
+	n, err := r.rd.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		// kept past midnight in case the clocks of the dynos disagree
+		if err := r.rd.Expire(ctx, key, 48*time.Hour).Err(); err != nil {
+			return false, err
+		}
+	}
+	if n > int64(cap) {
+		return false, r.rd.Decr(ctx, key).Err()
+	}
+	return true, nil
+}
@@ -0,0 +1,47 @@
+package destinations
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+// Router serves the account's own destination policies.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	hndlr := NewHandler(NewService(NewRepository(rs.db, rs.rd)))
+
+	r.Get("/", hndlr.list)
+	r.Put("/{country}", hndlr.put)
+	r.Delete("/{country}", hndlr.delete)
+
+	return r
+}
+
+// AdminRouter serves the default policy of every account. It must be
+// mounted behind admin authentication.
+func (rs *Resource) AdminRouter() *chi.Mux {
+	r := chi.NewRouter()
+
+	hndlr := NewHandler(NewService(NewRepository(rs.db, rs.rd)))
+
+	r.Get("/", hndlr.listDefaults)
+	r.Put("/{country}", hndlr.putDefault)
+	r.Delete("/{country}", hndlr.deleteDefault)
+
+	return r
+}
@@ -0,0 +1,154 @@
+package destinations
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/phone"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	list(ctx context.Context) ([]Policy, error)
+	put(ctx context.Context, country string, req PolicyReq, clientIP string) (*Policy, error)
+	delete(ctx context.Context, country, clientIP string) error
+	listDefaults(ctx context.Context) ([]Policy, error)
+	putDefault(ctx context.Context, country string, req PolicyReq) (*Policy, error)
+	deleteDefault(ctx context.Context, country string) error
+	// Check refuses messages of the account to to that its policy disables,
+	// with a CodeCountryDisabled error. It counts nothing, so it can run
+	// before the other checks of a message.
+	Check(ctx context.Context, accountId int64, to string) error
+	// Take counts a message of the account to to against the daily cap of
+	// its country, refusing it with a CodeDailyCapReached error once the
+	// cap is reached, or as Check does.
+	Take(ctx context.Context, accountId int64, to string) error
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+func notFound(country string) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no destination policy for %s", country))
+}
+
+// list returns the account's own policies, then the defaults.
+func (s service) list(ctx context.Context) ([]Policy, error) {
+	accountId := pkg.AccountID(ctx)
+	own, err := s.repo.list(ctx, &accountId)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := s.repo.list(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(own, defaults...), nil
+}
+
+func (s service) put(ctx context.Context, country string, req PolicyReq, clientIP string) (*Policy, error) {
+	accountId := pkg.AccountID(ctx)
+	return s.repo.put(ctx, &accountId, country, req, clientIP)
+}
+
+func (s service) delete(ctx context.Context, country, clientIP string) error {
+	accountId := pkg.AccountID(ctx)
+	ok, err := s.repo.delete(ctx, &accountId, country, clientIP)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound(country)
+	}
+	return nil
+}
+
+func (s service) listDefaults(ctx context.Context) ([]Policy, error) {
+	return s.repo.list(ctx, nil)
+}
+
+func (s service) putDefault(ctx context.Context, country string, req PolicyReq) (*Policy, error) {
+	p, err := s.repo.put(ctx, nil, country, req, "")
+	if err != nil {
+		return nil, err
+	}
+	pkg.Logger(ctx).WithFields(logrus.Fields{
+		"country":   p.Country,
+		"enabled":   p.Enabled,
+		"daily_cap": p.DailyCap,
+	}).Info("default destination policy set")
+	return p, nil
+}
+
+func (s service) deleteDefault(ctx context.Context, country string) error {
+	ok, err := s.repo.delete(ctx, nil, country, "")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound(country)
+	}
+	pkg.Logger(ctx).WithField("country", country).Info("default destination policy deleted")
+	return nil
+}
+
+// policy returns the policy of the account for the country of to, refusing
+// to when it has no known country or the policy disables it.
+func (s service) policy(ctx context.Context, accountId int64, to string) (*Policy, error) {
+	country := phone.Country(to)
+	if country == "" {
+		return nil, pkg.WithCode(http.StatusForbidden, CodeCountryDisabled,
+			errors.Errorf("to %s has no known country calling code", to))
+	}
+
+	p, err := s.repo.find(ctx, accountId, country)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &unrestricted
+	}
+
+	if !p.Enabled {
+		return nil, pkg.WithCode(http.StatusForbidden, CodeCountryDisabled,
+			errors.Errorf("sending to %s (%s) is disabled for the account", to, country))
+	}
+	return p, nil
+}
+
+func (s service) Check(ctx context.Context, accountId int64, to string) error {
+	_, err := s.policy(ctx, accountId, to)
+	return err
+}
+
+func (s service) Take(ctx context.Context, accountId int64, to string) error {
+	p, err := s.policy(ctx, accountId, to)
+	if err != nil || p.DailyCap <= 0 {
+		return err
+	}
+
+	country := phone.Country(to)
+	ok, err := s.repo.take(ctx, accountId, country, p.DailyCap, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		pkg.Logger(ctx).WithField("country", country).WithField("daily_cap", p.DailyCap).
+			Warn("destination daily cap reached")
+		return pkg.WithCode(http.StatusTooManyRequests, CodeDailyCapReached,
+			errors.Errorf("daily cap of %d messages to %s reached", p.DailyCap, country))
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keyPrefix prefixes both the stream keeping an account's recent events
+	// and the channel they are published on.
+	keyPrefix = "events:"
+	// backlog is how many events of an account can be resumed from.
+	backlog = 1000
+	// retention is how long the events of an idle account are kept.
+	retention = 24 * time.Hour
+	// bufferSize is how many events a slow subscriber may fall behind by
+	// before it is dropped. Its client resumes from the last event it got.
+	bufferSize = 64
+)
+
+// ErrClosed is returned when subscribing to a hub that has stopped.
+var ErrClosed = errors.New("event hub closed")
+
+func key(accountId int64) string {
+	return fmt.Sprintf("%s%d", keyPrefix, accountId)
+}
+
+// Publisher publishes the events of an account to every dyno.
+type Publisher interface {
+	Publish(ctx context.Context, accountId int64, typ string, data interface{}) error
+}
+
+type publisher struct {
+	rd *redis.Client
+}
+
+func NewPublisher(rd *redis.Client) Publisher {
+	return &publisher{rd: rd}
+}
+
+// Publish appends the event to the account's stream, which assigns its ID,
+// then publishes it for the streams open right now.
+func (p publisher) Publish(ctx context.Context, accountId int64, typ string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.rd.XAdd(ctx, &redis.XAddArgs{
+		Stream: key(accountId),
+		MaxLen: backlog,
+		Approx: true,
+		Values: map[string]interface{}{"type": typ, "data": string(raw)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(Event{ID: id, Type: typ, Data: raw})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.rd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key(accountId), retention)
+		pipe.Publish(ctx, key(accountId), string(payload))
+		return nil
+	})
+	return err
+}
+
+// Subscription receives the events of one account. C is closed when the
+// subscriber falls too far behind or the hub stops.
+type Subscription struct {
+	C <-chan Event
+
+	c         chan Event
+	accountId int64
+	hub       *Hub
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub fans the events published by every dyno out to the streams open on
+// this one, over a single redis subscription.
+type Hub struct {
+	rd *redis.Client
+
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub(rd *redis.Client) *Hub {
+	return &Hub{rd: rd, subs: map[int64]map[*Subscription]struct{}{}}
+}
+
+// Run delivers published events until ctx is done, then closes every
+// subscription.
+func (h *Hub) Run(ctx context.Context) {
+	log := pkg.Logger(ctx).WithField("context", "event_hub")
+
+	ps := h.rd.PSubscribe(ctx, keyPrefix+"*")
+	defer func() {
+		if err := ps.Close(); err != nil {
+			log.WithError(err).Error("unable to close the event subscription")
+		}
+		h.close()
+	}()
+
+	// the channel reconnects by itself when the connection drops
+	msgs := ps.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			accountId, err := strconv.ParseInt(strings.TrimPrefix(msg.Channel, keyPrefix), 10, 64)
+			if err != nil {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				log.WithError(err).Error("unable to decode event")
+				continue
+			}
+			h.dispatch(accountId, e)
+		}
+	}
+}
+
+func (h *Hub) dispatch(accountId int64, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs[accountId] {
+		select {
+		case s.c <- e:
+		default:
+			delete(h.subs[accountId], s)
+			close(s.c)
+		}
+	}
+}
+
+// Subscribe starts receiving the events of the account.
+func (h *Hub) Subscribe(accountId int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	c := make(chan Event, bufferSize)
+	s := &Subscription{C: c, c: c, accountId: accountId, hub: h}
+	if h.subs[accountId] == nil {
+		h.subs[accountId] = map[*Subscription]struct{}{}
+	}
+	h.subs[accountId][s] = struct{}{}
+	return s, nil
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[s.accountId][s]; !ok {
+		return
+	}
+	delete(h.subs[s.accountId], s)
+	if len(h.subs[s.accountId]) == 0 {
+		delete(h.subs, s.accountId)
+	}
+	close(s.c)
+}
+
+func (h *Hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subs {
+		for s := range subs {
+			close(s.c)
+		}
+	}
+	h.subs = map[int64]map[*Subscription]struct{}{}
+}
+
+// Since returns the account's events after the one with lastID, oldest
+// first. Events older than the backlog are lost.
+func (h *Hub) Since(ctx context.Context, accountId int64, lastID string) ([]Event, error) {
+	msgs, err := h.rd.XRangeN(ctx, key(accountId), lastID, "+", backlog+1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, msg := range msgs {
+		// the range includes lastID itself
+		if !After(msg.ID, lastID) {
+			continue
+		}
+		typ, _ := msg.Values["type"].(string)
+		data, _ := msg.Values["data"].(string)
+		events = append(events, Event{ID: msg.ID, Type: typ, Data: json.RawMessage(data)})
+	}
+	return events, nil
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types.
+const (
+	TypeInbound = "message.inbound"
+	TypeStatus  = "message.status"
+	// TypeHeartbeat keeps idle WebSocket streams open. SSE streams use
+	// comments instead.
+	TypeHeartbeat = "heartbeat"
+)
+
+// Event is a change to one of an account's messages, pushed to the
+// account's streams. IDs are those of the account's redis stream, so a
+// client can resume after the last event it saw.
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Message is the data of message events.
+type Message struct {
+	ID             int64      `json:"id" db:"id"`
+	ConversationID *int64     `json:"conversation_id,omitempty" db:"conversation_id"`
+	Direction      string     `json:"direction" db:"direction"`
+	From           string     `json:"from" db:"from_number"`
+	To             string     `json:"to" db:"to_number"`
+	Text           string     `json:"text" db:"text"`
+	Status         string     `json:"status" db:"status"`
+	Error          *string    `json:"error,omitempty" db:"error"`
+	SendAt         *time.Time `json:"send_at,omitempty" db:"send_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ParseID checks id is a redis stream ID, as sent back in Last-Event-ID.
+func ParseID(id string) error {
+	if _, _, err := splitID(id); err != nil {
+		return errors.Errorf("%q is not a valid event id", id)
+	}
+	return nil
+}
+
+func splitID(id string) (ms, seq uint64, err error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("missing sequence")
+	}
+	if ms, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return ms, seq, nil
+}
+
+// After reports whether the event with id a was added after the one with
+// id b. Invalid IDs are never after anything.
+func After(a, b string) bool {
+	ams, aseq, err := splitID(a)
+	if err != nil {
+		return false
+	}
+	bms, bseq, err := splitID(b)
+	if err != nil {
+		return true
+	}
+	return ams > bms || ams == bms && aseq > bseq
+}
@@ -0,0 +1,62 @@
+package fraud
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func accountID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid account id"))
+	}
+	return id, nil
+}
+
+func (h Handler) policy(w http.ResponseWriter, r *http.Request) {
+	id, err := accountID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	p, err := h.svc.policy(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, p)
+}
+
+func (h Handler) putPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := accountID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req PolicyReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	p, err := h.svc.putPolicy(r.Context(), id, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, p)
+}
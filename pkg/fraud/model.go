@@ -0,0 +1,110 @@
+package fraud
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signals of suspicious traffic, and what each adds to the score.
+const (
+	// SignalSequential is a burst of messages to numbers that only differ
+	// in their last digits, as a pumping script walks a number range.
+	SignalSequential = "sequential_numbers"
+	// SignalCostSpike is a sudden rise of the account's messages to a
+	// high-cost country.
+	SignalCostSpike = "high_cost_spike"
+	// SignalDiversity is a sender whose every message goes to another
+	// number, many more of them than usual.
+	SignalDiversity = "to_diversity"
+)
+
+var weights = map[string]int{
+	SignalSequential: 60,
+	SignalCostSpike:  60,
+	SignalDiversity:  40,
+}
+
+const (
+	// sequentialDigits are the last digits that vary within a block of
+	// sequential numbers; messages to sequentialMin numbers of one block
+	// within sequentialWindow are a burst.
+	sequentialDigits = 2
+	sequentialMin    = 10
+	sequentialWindow = 10 * time.Minute
+
+	// spikeMin messages to a high-cost country within the last hour are a
+	// spike when they are over spikeFactor times the hourly average of the
+	// previous UTC day. Accounts that sent fewer than spikeBaseline messages
+	// to the country that day have no average to compare with.
+	spikeMin      = 20
+	spikeFactor   = 3
+	spikeBaseline = 24
+
+	// diversityMin distinct recipients of a sender within the hour are
+	// unusual when they make up at least diversityShare of its messages.
+	diversityMin   = 50
+	diversityShare = 0.95
+)
+
+// Policy actions.
+const (
+	ActionFlag   = "flag"
+	ActionHold   = "hold"
+	ActionReject = "reject"
+)
+
+// CodeSuspected is the error code of messages rejected as suspected fraud.
+const CodeSuspected = "suspected_fraud"
+
+// Policy says what happens to the messages of an account whose score
+// reaches Threshold.
+type Policy struct {
+	AccountID int64     `json:"account_id" db:"account_id"`
+	Action    string    `json:"action" db:"action"`
+	Threshold int       `json:"threshold" db:"threshold"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DefaultPolicy is the policy of accounts without one.
+var DefaultPolicy = Policy{Action: ActionHold, Threshold: 50}
+
+// PolicyReq sets the policy of an account.
+type PolicyReq struct {
+	Action    string `json:"action"`
+	Threshold int    `json:"threshold"`
+}
+
+func (v *PolicyReq) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.IntIsGreaterThan{Name: "threshold", Field: v.Threshold, Compared: 0, Message: fmt.Sprintf("%s is invalid", "threshold")},
+	)
+	switch v.Action {
+	case ActionFlag, ActionHold, ActionReject:
+	default:
+		err1.Add("action", fmt.Sprintf("action must be %s, %s or %s", ActionFlag, ActionHold, ActionReject))
+	}
+
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
+
+// Verdict is the score of a message, the signals behind it and, when it
+// reaches the threshold of the account's policy, the action to take.
+type Verdict struct {
+	Score   int
+	Signals []string
+	// Action is ActionHold or ActionReject when the message must not be
+	// sent right away, and "" otherwise.
+	Action string
+}
+
+func (v Verdict) String() string {
+	return fmt.Sprintf("fraud score %d (%s)", v.Score, strings.Join(v.Signals, ", "))
+}
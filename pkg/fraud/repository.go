@@ -0,0 +1,109 @@
+package fraud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"time"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	accountExists(ctx context.Context, accountId int64) (bool, error)
+	findPolicy(ctx context.Context, accountId int64) (*Policy, error)
+	putPolicy(ctx context.Context, accountId int64, req PolicyReq) (*Policy, error)
+	count(ctx context.Context, key string, length time.Duration, now time.Time) (float64, error)
+	daily(ctx context.Context, key string, now time.Time) (int, int, error)
+	distinct(ctx context.Context, key, member string, length time.Duration, now time.Time) (int64, int64, error)
+}
+
+type repository struct {
+	db      *sqlx.DB
+	rd      *redis.Client
+	counter middleware2.LimitCounter
+}
+
+// NewRepository keeps the counts behind the signals in the same redis
+// counter as the rate limits, under their own keys.
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{
+		db:      db,
+		rd:      rd,
+		counter: middleware2.NewRedisLimitCounter(rd, "ratelimit:", 48*time.Hour),
+	}
+}
+
+func (r repository) accountExists(ctx context.Context, accountId int64) (bool, error) {
+	var ok bool
+	err := r.db.GetContext(ctx, &ok, `SELECT EXISTS (SELECT 1 FROM account WHERE id = $1)`, accountId)
+	return ok, err
+}
+
+// findPolicy returns nil when the account has no policy of its own.
+func (r repository) findPolicy(ctx context.Context, accountId int64) (*Policy, error) {
+	var p Policy
+	err := r.db.GetContext(ctx, &p, `SELECT * FROM fraud_policy WHERE account_id = $1`, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r repository) putPolicy(ctx context.Context, accountId int64, req PolicyReq) (*Policy, error) {
+	var p Policy
+	err := r.db.GetContext(ctx, &p, `INSERT INTO fraud_policy (account_id, action, threshold) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id) DO UPDATE SET action = EXCLUDED.action, threshold = EXCLUDED.threshold, updated_at = now()
+		RETURNING *`, accountId, req.Action, req.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// count counts one more message for key and returns the messages of the
+// sliding window of length ending at now.
+func (r repository) count(ctx context.Context, key string, length time.Duration, now time.Time) (float64, error) {
+	n, err := middleware2.Count(ctx, r.counter, "fraud/"+key, length, now)
+	return n, err
+}
+
+// daily counts one more message for key on the UTC day of now, and returns
+// the messages of that day and of the day before.
+func (r repository) daily(ctx context.Context, key string, now time.Time) (int, int, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+
+	err := r.counter.Increment(ctx, "fraud/"+key, day)
+	var today, yesterday int
+	if err == nil {
+		today, yesterday, err = r.counter.Get(ctx, "fraud/"+key, day, day.Add(-24*time.Hour))
+	}
+	return today, yesterday, err
+}
+
+// distinct adds member to the set of key for the fixed window of length
+// holding now, and returns about how many distinct members were added in
+// the window, and how many in all.
+func (r repository) distinct(ctx context.Context, key, member string, length time.Duration, now time.Time) (int64, int64, error) {
+	k := fmt.Sprintf("fraud:distinct:%s:%d", key, now.UTC().Truncate(length).Unix())
+
+	pipe := r.rd.TxPipeline()
+	pipe.PFAdd(ctx, k, member)
+	total := pipe.Incr(ctx, k+":n")
+	pipe.Expire(ctx, k, 2*length)
+	pipe.Expire(ctx, k+":n", 2*length)
+	members := pipe.PFCount(ctx, k)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return members.Val(), total.Val(), nil
+}
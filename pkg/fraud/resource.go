@@ -0,0 +1,33 @@
+package fraud
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+// Router serves the admin routes for the fraud policies of accounts. It
+// must be mounted behind admin authentication.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	hndlr := NewHandler(NewService(NewRepository(rs.db, rs.rd)))
+
+	r.Get("/accounts/{id}/policy", hndlr.policy)
+	r.Put("/accounts/{id}/policy", hndlr.putPolicy)
+
+	return r
+}
@@ -0,0 +1,187 @@
+package fraud
+
+import (
+	"context"
+	"fmt"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/phone"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	policy(ctx context.Context, accountId int64) (*Policy, error)
+	putPolicy(ctx context.Context, accountId int64, req PolicyReq) (*Policy, error)
+	// Screen scores a message the account is about to send and decides,
+	// by the account's policy, whether it may be sent right away.
+	Screen(ctx context.Context, accountId int64, req pkg.PostReq) (Verdict, error)
+}
+
+var (
+	highCostMu sync.RWMutex
+	// highCost are the countries whose spikes are a signal, by default
+	// numbers of no country, which satellite and premium services use.
+	highCost = map[string]bool{phone.NonGeographic: true}
+)
+
+// SetHighCostCountries replaces the countries, by ISO 3166-1 alpha-2 code
+// or phone.NonGeographic, whose spikes are a signal.
+func SetHighCostCountries(countries []string) {
+	m := make(map[string]bool, len(countries))
+	for _, c := range countries {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			m[c] = true
+		}
+	}
+
+	highCostMu.Lock()
+	defer highCostMu.Unlock()
+	highCost = m
+}
+
+func isHighCost(country string) bool {
+	highCostMu.RLock()
+	defer highCostMu.RUnlock()
+	return highCost[country]
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+func (s service) checkAccount(ctx context.Context, accountId int64) error {
+	ok, err := s.repo.accountExists(ctx, accountId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no account with id %d", accountId))
+	}
+	return nil
+}
+
+// policy returns the account's policy, or DefaultPolicy when it has none.
+func (s service) policy(ctx context.Context, accountId int64) (*Policy, error) {
+	if err := s.checkAccount(ctx, accountId); err != nil {
+		return nil, err
+	}
+	p, err := s.repo.findPolicy(ctx, accountId)
+	if err != nil || p != nil {
+		return p, err
+	}
+	def := DefaultPolicy
+	def.AccountID = accountId
+	return &def, nil
+}
+
+func (s service) putPolicy(ctx context.Context, accountId int64, req PolicyReq) (*Policy, error) {
+	if err := s.checkAccount(ctx, accountId); err != nil {
+		return nil, err
+	}
+	p, err := s.repo.putPolicy(ctx, accountId, req)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Logger(ctx).WithFields(logrus.Fields{
+		"account_id": accountId,
+		"action":     p.Action,
+		"threshold":  p.Threshold,
+	}).Info("fraud policy set")
+	return p, nil
+}
+
+// Screen counts the message towards every signal before scoring it, so
+// that held and rejected messages still count as traffic.
+func (s service) Screen(ctx context.Context, accountId int64, req pkg.PostReq) (v Verdict, err error) {
+	ctx, span := pkg.StartSpan(ctx, "fraud.service.Screen",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	signals, err := s.signals(ctx, accountId, req, time.Now())
+	if err != nil {
+		return Verdict{}, err
+	}
+	if len(signals) == 0 {
+		return Verdict{}, nil
+	}
+
+	v.Signals = signals
+	for _, sig := range signals {
+		v.Score += weights[sig]
+	}
+
+	p, err := s.repo.findPolicy(ctx, accountId)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if p == nil {
+		p = &DefaultPolicy
+	}
+	if v.Score >= p.Threshold && p.Action != ActionFlag {
+		v.Action = p.Action
+	}
+
+	pkg.Logger(ctx).WithFields(pkg.SMSFields(req)).WithFields(logrus.Fields{
+		"fraud_score":   v.Score,
+		"fraud_signals": strings.Join(v.Signals, ","),
+		"fraud_action":  v.Action,
+	}).Warn("suspicious outbound message")
+	return v, nil
+}
+
+func (s service) signals(ctx context.Context, accountId int64, req pkg.PostReq, now time.Time) ([]string, error) {
+	var signals []string
+	to := strings.TrimPrefix(req.To, "+")
+
+	if len(to) > sequentialDigits {
+		// distinct numbers, so a conversation with one number is no burst
+		block := to[:len(to)-sequentialDigits]
+		n, _, err := s.repo.distinct(ctx, fmt.Sprintf("seq/%d/%s", accountId, block), to, sequentialWindow, now)
+		if err != nil {
+			return nil, err
+		}
+		if n >= sequentialMin {
+			signals = append(signals, SignalSequential)
+		}
+	}
+
+	if country := phone.Country(to); isHighCost(country) {
+		hour, err := s.repo.count(ctx, fmt.Sprintf("cost-hour/%d/%s", accountId, country), time.Hour, now)
+		if err != nil {
+			return nil, err
+		}
+		// the day before is the baseline, so the spike cannot raise its own
+		// average, and accounts without one have nothing to spike from
+		_, yesterday, err := s.repo.daily(ctx, fmt.Sprintf("cost-day/%d/%s", accountId, country), now)
+		if err != nil {
+			return nil, err
+		}
+		if yesterday >= spikeBaseline && hour >= spikeMin && hour > spikeFactor*float64(yesterday)/24 {
+			signals = append(signals, SignalCostSpike)
+		}
+	}
+
+	recipients, sent, err := s.repo.distinct(ctx, fmt.Sprintf("to/%d/%s", accountId, req.From), to, time.Hour, now)
+	if err != nil {
+		return nil, err
+	}
+	if recipients >= diversityMin && float64(recipients) >= diversityShare*float64(sent) {
+		signals = append(signals, SignalDiversity)
+	}
+	return signals, nil
+}
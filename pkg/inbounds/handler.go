@@ -2,20 +2,33 @@ package inbounds
 
 import (
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
 	"net/http"
 )
 
 type Handler struct {
-	svc Service
+	svc     Service
+	limiter Limiter
+	hub     Hub
 }
 
-func NewHandler(svc Service) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc Service, limiter Limiter, hub Hub) *Handler {
+	return &Handler{svc: svc, limiter: limiter, hub: hub}
 }
 
 func (h Handler) post(w http.ResponseWriter, r *http.Request) {
+	req := pkg.GetDecodedPostRequest(r.Context())
+	if len(req.FromPool) > 0 {
+		pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("from_pool is only supported for outbound sms")))
+		return
+	}
+
+	// auto-replies are rate limited as if they had been sent on their own
+	allow := func(msg pkg.PostReq) (bool, error) {
+		return h.limiter.Allow(r.WithContext(pkg.WithPostRequest(r.Context(), msg)))
+	}
 
-	err := h.svc.post(r.Context(), pkg.GetDecodedPostRequest())
+	err := h.svc.post(r.Context(), req, allow)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
@@ -3,11 +3,12 @@ package inbounds
 import (
 	"context"
 	"fmt"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/conversations"
+	"github.com/olusolaa/go-backend/pkg/events"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"time"
 )
 
@@ -15,17 +16,28 @@ var (
 	_ Repository = repository{} // Verify that repository implements Repository.
 )
 
+// StatusReceived is the status of inbound messages.
+const StatusReceived = "received"
+
 type Repository interface {
 	post(ctx context.Context, req pkg.PostReq, accountId int64) error
+	record(ctx context.Context, req pkg.PostReq, accountId int64) error
 }
 
 type repository struct {
-	db *sqlx.DB
-	rd *redis.Client
+	db            *sqlx.DB
+	rd            *redis.Client
+	conversations conversations.Repository
+	events        events.Publisher
 }
 
 func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
-	return &repository{db: db, rd: rd}
+	return &repository{
+		db:            db,
+		rd:            rd,
+		conversations: conversations.NewRepository(db, rd),
+		events:        events.NewPublisher(rd),
+	}
 }
 
 func (r repository) post(ctx context.Context, req pkg.PostReq, accountId int64) error {
@@ -39,13 +51,37 @@ func (r repository) post(ctx context.Context, req pkg.PostReq, accountId int64)
 	}
 
 	if req.Text == "stop" {
-		log.Info("STOP command received")
-		err := r.rd.Set(fmt.Sprintf("%s:%s", req.From, req.To),
+		pkg.Logger(ctx).WithFields(pkg.SMSFields(req)).Info("STOP command received")
+		err := r.rd.Set(ctx, fmt.Sprintf("%s:%s", req.From, req.To),
 			fmt.Sprintf("%s:%s", req.To, req.From), time.Hour*4).Err()
 		if err != nil {
-			log.Info("error %s", err)
+			pkg.Logger(ctx).WithError(err).Error("unable to store STOP request")
 		}
 	}
 
 	return nil
 }
+
+// record stores an inbound message in the conversation between the
+// account's number it was sent to and the remote number it came from, and
+// pushes it to the account's streams.
+func (r repository) record(ctx context.Context, req pkg.PostReq, accountId int64) error {
+	convId, err := r.conversations.Attach(ctx, accountId, req.To, req.From, conversations.DirectionInbound)
+	if err != nil {
+		return err
+	}
+
+	var m events.Message
+	err = r.db.GetContext(ctx, &m, `INSERT INTO message (account_id, from_number, to_number, text, status, sent_at, direction, conversation_id)
+		VALUES ($1, $2, $3, $4, $5, now(), $6, $7) RETURNING *`,
+		accountId, req.From, req.To, req.Text, StatusReceived, conversations.DirectionInbound, convId)
+	if err != nil {
+		return err
+	}
+
+	// the message is stored whether or not it can be pushed
+	if err := r.events.Publish(ctx, accountId, events.TypeInbound, m); err != nil {
+		pkg.Logger(ctx).WithError(err).WithField("message_id", m.ID).Error("unable to publish inbound message")
+	}
+	return nil
+}
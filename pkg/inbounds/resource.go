@@ -2,31 +2,62 @@ package inbounds
 
 import (
 	"github.com/go-chi/chi"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/rules"
+	"github.com/olusolaa/go-backend/pkg/templates"
+	"net/http"
 )
 
+// Limiter is the rate limiter applied to incoming messages. Allow limits
+// the auto-replies they trigger as outgoing messages.
+type Limiter interface {
+	Handler(next http.Handler) http.Handler
+	Allow(r *http.Request) (bool, error)
+}
+
 type Resource struct {
-	db *sqlx.DB
-	rd *redis.Client
+	db      *sqlx.DB
+	rd      *redis.Client
+	limiter Limiter
+	hub     Hub
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+func NewResource(db *sqlx.DB, rd *redis.Client, limiter Limiter, hub Hub) *Resource {
 	return &Resource{
-		db: db,
-		rd: rd,
+		db:      db,
+		rd:      rd,
+		limiter: limiter,
+		hub:     hub,
 	}
 }
 
 func (rs *Resource) Router() *chi.Mux {
 	r := chi.NewRouter()
 
-	repo := NewRepository(rs.db, rs.rd)
-	svc := NewService(repo)
-	hndlr := NewHandler(svc)
+	svc := NewDefaultService(rs.db, rs.rd)
+	hndlr := NewHandler(svc, rs.limiter, rs.hub)
 
-	r.Post("/sms", hndlr.post)
+	r.With(pkg.DecodePostRequest(), rs.limiter.Handler).Post("/sms", hndlr.post)
+	r.Get("/stream", hndlr.stream)
 
 	return r
 }
+
+// NewDefaultService returns the service with the auto-reply rules wired in,
+// as the routes use it.
+func NewDefaultService(db *sqlx.DB, rd *redis.Client) Service {
+	contactsSvc := contacts.NewService(contacts.NewRepository(db, rd))
+	responder := rules.NewService(rules.NewRepository(db, rd),
+		outbounds.NewService(outbounds.NewRepository(db, rd),
+			templates.NewService(templates.NewRepository(db, rd)),
+			contactsSvc,
+		),
+		contactsSvc,
+	)
+	return NewService(NewRepository(db, rd), responder)
+}
@@ -2,28 +2,57 @@ package inbounds
 
 import (
 	"context"
-	middleware2 "github.com/olusolaa/go-backend/middleware"
 	"github.com/olusolaa/go-backend/pkg"
 )
 
 var _ Service = service{} // Verify that service implements Service.
 
 type Service interface {
-	post(context context.Context, req pkg.PostReq) error
+	post(context context.Context, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) error
+	// Receive records req as received by one of the account's numbers and
+	// sends its auto-reply, if any, consuming the rate limit through allow.
+	Receive(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) error
+}
+
+// Responder sends the auto-replies of inbound messages.
+type Responder interface {
+	Respond(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) error
 }
 
 type service struct {
-	repo Repository
+	repo      Repository
+	responder Responder
 }
 
-func NewService(repo Repository) Service {
+func NewService(repo Repository, responder Responder) Service {
 	svc := &service{
-		repo: repo,
+		repo:      repo,
+		responder: responder,
 	}
 	return svc
 }
 
-func (s service) post(ctx context.Context, req pkg.PostReq) error {
-	accountId := middleware2.GetAuthUserId()
-	return s.repo.post(ctx, req, accountId)
+func (s service) post(ctx context.Context, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) error {
+	return s.Receive(ctx, pkg.AccountID(ctx), req, allow)
+}
+
+func (s service) Receive(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (err error) {
+	ctx, span := pkg.StartSpan(ctx, "inbounds.service.Receive",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("inbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	if err := s.repo.post(ctx, req, accountId); err != nil {
+		return err
+	}
+	if err := s.repo.record(ctx, req, accountId); err != nil {
+		return err
+	}
+
+	// the message was received whether or not a reply could be sent
+	if err := s.responder.Respond(ctx, accountId, req, allow); err != nil {
+		pkg.Logger(ctx).WithError(err).WithFields(pkg.SMSFields(req)).Error("unable to send auto-reply")
+	}
+	return nil
 }
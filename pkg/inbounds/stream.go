@@ -0,0 +1,238 @@
+package inbounds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/events"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// heartbeat is how often an idle stream is written to, so proxies keep
+	// it open and a gone client is noticed.
+	heartbeat = 15 * time.Second
+	// writeTimeout bounds each write to a stream.
+	writeTimeout = 10 * time.Second
+	// retryMillis is how long EventSource clients wait before reconnecting.
+	retryMillis = 3000
+)
+
+// Hub is where streams get the account's events from.
+type Hub interface {
+	Subscribe(accountId int64) (*events.Subscription, error)
+	Since(ctx context.Context, accountId int64, lastID string) ([]events.Event, error)
+}
+
+// sink writes events to one client.
+type sink interface {
+	send(e events.Event) error
+	heartbeat() error
+}
+
+// stream pushes the account's events over SSE, or over a WebSocket when
+// the client asks for an upgrade. Clients resume after the event named by
+// Last-Event-ID, or ?last_event_id= where they cannot set headers.
+func (h Handler) stream(w http.ResponseWriter, r *http.Request) {
+	accountId := pkg.AccountID(r.Context())
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if lastID != "" {
+		if err := events.ParseID(lastID); err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, err))
+			return
+		}
+	}
+
+	isWebsocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	if !isWebsocket && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		pkg.Render(w, r, pkg.WithStatus(http.StatusNotAcceptable,
+			errors.New("stream requires Accept: text/event-stream or a websocket upgrade")))
+		return
+	}
+
+	// subscribe before reading the backlog so no event falls in between
+	sub, err := h.hub.Subscribe(accountId)
+	if err != nil {
+		pkg.Render(w, r, pkg.WithStatus(http.StatusServiceUnavailable, err))
+		return
+	}
+	defer sub.Close()
+
+	var backlog []events.Event
+	if lastID != "" {
+		if backlog, err = h.hub.Since(r.Context(), accountId, lastID); err != nil {
+			pkg.Render(w, r, err)
+			return
+		}
+	}
+
+	if isWebsocket {
+		// origins are not checked, as for every other route (see CORS)
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			_ = ws.SetDeadline(time.Time{})
+			go func() {
+				// reading handles pings and notices the client leaving
+				var msg string
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+				cancel()
+			}()
+			pump(ctx, wsSink{ws: ws}, sub, backlog, lastID)
+		}}.ServeHTTP(w, r)
+		return
+	}
+
+	s, err := startSSE(w)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	defer s.conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// the client sends nothing more; reading notices it leaving
+		_, _ = io.Copy(io.Discard, s.buf)
+		cancel()
+	}()
+	pump(ctx, s, sub, backlog, lastID)
+}
+
+// pump sends the backlog, then live events, until ctx is done, the
+// subscription ends or a write fails.
+func pump(ctx context.Context, s sink, sub *events.Subscription, backlog []events.Event, lastID string) {
+	log := pkg.Logger(ctx)
+
+	for _, e := range backlog {
+		if err := s.send(e); err != nil {
+			log.WithError(err).Info("stream closed")
+			return
+		}
+		lastID = e.ID
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// the client resumes from the last event it got
+				return
+			}
+			if lastID != "" && !events.After(e.ID, lastID) {
+				// already sent with the backlog
+				continue
+			}
+			err = s.send(e)
+			lastID = e.ID
+		case <-ticker.C:
+			err = s.heartbeat()
+		}
+		if err != nil {
+			log.WithError(err).Info("stream closed")
+			return
+		}
+	}
+}
+
+// sseSink writes to a hijacked connection, so the server's write timeout
+// can be pushed back on every write.
+type sseSink struct {
+	conn net.Conn
+	buf  *bufio.ReadWriter
+}
+
+func startSSE(w http.ResponseWriter) (*sseSink, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	header := w.Header().Clone()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	s := &sseSink{conn: conn, buf: buf}
+	err = s.write(func() error {
+		if _, err := buf.WriteString("HTTP/1.1 200 OK\r\n"); err != nil {
+			return err
+		}
+		if err := header.Write(buf); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(buf, "\r\nretry: %d\n\n", retryMillis)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s sseSink) write(fn func() error) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.buf.Flush()
+}
+
+func (s sseSink) send(e events.Event) error {
+	return s.write(func() error {
+		_, err := fmt.Fprintf(s.buf, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+		return err
+	})
+}
+
+func (s sseSink) heartbeat() error {
+	return s.write(func() error {
+		_, err := s.buf.WriteString(": heartbeat\n\n")
+		return err
+	})
+}
+
+// wsSink sends each event as a JSON text frame.
+type wsSink struct {
+	ws *websocket.Conn
+}
+
+func (s wsSink) send(e events.Event) error {
+	if err := s.ws.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(s.ws, e)
+}
+
+func (s wsSink) heartbeat() error {
+	return s.send(events.Event{Type: events.TypeHeartbeat})
+}
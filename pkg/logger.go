@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+type loggerCtxKey struct{}
+
+var logMessageText bool
+
+// SetLogMessageText controls whether SMSFields includes the message text.
+// It is meant to be called once at startup.
+func SetLogMessageText(enabled bool) {
+	logMessageText = enabled
+}
+
+// WithLogger returns a copy of ctx carrying the request scoped logger.
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, entry)
+}
+
+// Logger returns the request scoped logger stored in ctx, or the standard
+// logger when there is none.
+func Logger(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerCtxKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// AddLogFields adds fields to the request scoped logger in ctx so they also
+// show up on the access log line written when the request completes.
+func AddLogFields(ctx context.Context, fields logrus.Fields) {
+	entry, ok := ctx.Value(loggerCtxKey{}).(*logrus.Entry)
+	if !ok {
+		return
+	}
+	for k, v := range fields {
+		entry.Data[k] = v
+	}
+}
+
+// MaskPhone hides the middle digits of a phone number, keeping enough of
+// the prefix and suffix to correlate log lines.
+func MaskPhone(number string) string {
+	switch n := len(number); {
+	case n <= 4:
+		return strings.Repeat("*", n)
+	case n < 10:
+		return strings.Repeat("*", n-2) + number[n-2:]
+	default:
+		return number[:4] + strings.Repeat("*", n-7) + number[n-3:]
+	}
+}
+
+// SMSFields returns log fields describing req with the phone numbers masked.
+// The text is left out unless enabled with SetLogMessageText.
+func SMSFields(req PostReq) logrus.Fields {
+	fields := logrus.Fields{
+		"from": MaskPhone(req.From),
+		"to":   MaskPhone(req.To),
+	}
+	if logMessageText {
+		fields["text"] = req.Text
+	}
+	return fields
+}
@@ -1,26 +1,165 @@
 package outbounds
 
 import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
 	"net/http"
+	"strconv"
 )
 
 type Handler struct {
-	svc Service
+	svc     Service
+	limiter Limiter
 }
 
-func NewHandler(svc Service) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc Service, limiter Limiter) *Handler {
+	return &Handler{svc: svc, limiter: limiter}
 }
 
 func (h Handler) post(w http.ResponseWriter, r *http.Request) {
+	req := pkg.GetDecodedPostRequest(r.Context())
+	if req.SendAt != nil {
+		h.schedule(w, r, req)
+		return
+	}
 
-	err := h.svc.post(r.Context(), pkg.GetDecodedPostRequest())
+	// only from_pool messages reach here unlimited: their sender is picked
+	// by the service
+	allow := func(msg pkg.PostReq) (bool, error) {
+		return h.limiter.Allow(r.WithContext(pkg.WithPostRequest(r.Context(), msg)))
+	}
+
+	msg, err := h.svc.post(r.Context(), req, allow)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
 	}
 
+	if len(req.FromPool) > 0 || msg.Status == StatusHeld {
+		// the caller needs to learn which sender was picked, or that the
+		// message was held
+		pkg.Render(w, r, msg)
+		return
+	}
 	pkg.Render(w, r, "outbound sms ok")
 
 }
+
+func (h Handler) postBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	// each message is rate limited as if it had been sent on its own
+	allow := func(msg pkg.PostReq) (bool, error) {
+		return h.limiter.Allow(r.WithContext(pkg.WithPostRequest(r.Context(), msg)))
+	}
+
+	var results []BatchResult
+	var err error
+	if req.GroupID != nil {
+		results, err = h.svc.postGroup(r.Context(), req, allow)
+	} else {
+		results, err = h.svc.postBatch(r.Context(), req.Requests(), allow)
+	}
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, results)
+}
+
+func (h Handler) schedule(w http.ResponseWriter, r *http.Request, req pkg.PostReq) {
+	// kept so the rate limit can be applied as for a direct send
+	clientIP, err := middleware2.KeyByIP(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	msg, err := h.svc.schedule(r.Context(), req, clientIP)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, msg)
+}
+
+func (h Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid message id")))
+		return
+	}
+
+	if err := h.svc.cancel(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, "scheduled sms cancelled")
+}
+
+func heldID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid message id"))
+	}
+	return id, nil
+}
+
+// listHeld lists held messages, of the account of ?account_id= if given.
+func (h Handler) listHeld(w http.ResponseWriter, r *http.Request) {
+	var accountId int64
+	if v := r.URL.Query().Get("account_id"); v != "" {
+		var err error
+		if accountId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			pkg.Render(w, r, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid account id")))
+			return
+		}
+	}
+
+	held, err := h.svc.listHeld(r.Context(), accountId)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, held)
+}
+
+func (h Handler) releaseHeld(w http.ResponseWriter, r *http.Request) {
+	id, err := heldID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	msg, err := h.svc.releaseHeld(r.Context(), id, middleware2.ClientIP(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, msg)
+}
+
+func (h Handler) dropHeld(w http.ResponseWriter, r *http.Request) {
+	id, err := heldID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	msg, err := h.svc.dropHeld(r.Context(), id, middleware2.ClientIP(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, msg)
+}
@@ -0,0 +1,164 @@
+package outbounds
+
+import (
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/events"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+// MaxBatchSize is the most messages a single batch request may carry.
+const MaxBatchSize = 100
+
+// Batch result statuses.
+const (
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+	// StatusSkipped marks group members left out of a group send because
+	// they sent STOP to the sender.
+	StatusSkipped = "skipped"
+)
+
+// Message statuses.
+const (
+	StatusScheduled = "scheduled"
+	StatusSent      = "sent"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	// StatusHeld marks messages held for review as suspected fraud, until
+	// a reviewer sends them or drops them, as StatusDropped.
+	StatusHeld    = "held"
+	StatusDropped = "dropped"
+)
+
+// Audit actions of the review of held messages.
+const (
+	ActionRelease = "fraud.release"
+	ActionDrop    = "fraud.drop"
+)
+
+// Message is an outbound message kept in the message table.
+type Message struct {
+	ID        int64      `json:"id" db:"id"`
+	AccountID int64      `json:"-" db:"account_id"`
+	From      string     `json:"from" db:"from_number"`
+	To        string     `json:"to" db:"to_number"`
+	Text      string     `json:"-" db:"text"`
+	Status    string     `json:"status" db:"status"`
+	Error     *string    `json:"error,omitempty" db:"error"`
+	ClientIP  string     `json:"-" db:"client_ip"`
+	SendAt    *time.Time `json:"send_at,omitempty" db:"send_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	// TemplateID and TemplateVersion record the template the text was
+	// rendered from, if any.
+	TemplateID      *int64 `json:"template_id,omitempty" db:"template_id"`
+	TemplateVersion *int   `json:"template_version,omitempty" db:"template_version"`
+	Direction       string `json:"-" db:"direction"`
+	ConversationID  *int64 `json:"conversation_id,omitempty" db:"conversation_id"`
+	// FraudScore and FraudSignals record why a message was held.
+	FraudScore   *int    `json:"fraud_score,omitempty" db:"fraud_score"`
+	FraudSignals *string `json:"fraud_signals,omitempty" db:"fraud_signals"`
+}
+
+// HeldMessage is a held message as reviewers see it, text included.
+type HeldMessage struct {
+	Message
+	AccountID int64  `json:"account_id"`
+	Text      string `json:"text"`
+}
+
+func (m Message) held() HeldMessage {
+	return HeldMessage{Message: m, AccountID: m.AccountID, Text: m.Text}
+}
+
+// Event returns the message as pushed to the account's streams.
+func (m Message) Event() events.Message {
+	return events.Message{
+		ID:             m.ID,
+		ConversationID: m.ConversationID,
+		Direction:      m.Direction,
+		From:           m.From,
+		To:             m.To,
+		Text:           m.Text,
+		Status:         m.Status,
+		Error:          m.Error,
+		SendAt:         m.SendAt,
+		SentAt:         m.SentAt,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// PostReq returns the request the message was created from.
+func (m Message) PostReq() pkg.PostReq {
+	return pkg.PostReq{From: m.From, To: m.To, Text: m.Text}
+}
+
+// BatchReq is the body of a batch send. It either carries one text, or
+// template, sent from one number, or a number of FromPool, to every number
+// in To or every member of the contact group GroupID, or a list of full
+// Messages.
+type BatchReq struct {
+	From       string            `json:"from,omitempty"`
+	FromPool   []string          `json:"from_pool,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	TemplateID *int64            `json:"template_id,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	To         []string          `json:"to,omitempty"`
+	GroupID    *int64            `json:"group_id,omitempty"`
+	Messages   []pkg.PostReq     `json:"messages,omitempty"`
+}
+
+func (b *BatchReq) Bind(r *http.Request) error {
+	n := len(b.To) + len(b.Messages)
+	switch {
+	case b.GroupID != nil && n > 0:
+		return errors.New("send either group_id, to or messages, not several")
+	case b.GroupID != nil:
+		// the group size is bounded by contacts.MaxGroupSize
+		return nil
+	case len(b.To) > 0 && len(b.Messages) > 0:
+		return errors.New("send either to or messages, not both")
+	case n == 0:
+		return errors.New("to, group_id or messages is missing")
+	case n > MaxBatchSize:
+		return errors.Errorf("a batch may hold at most %d messages", MaxBatchSize)
+	}
+	return nil
+}
+
+// Requests expands the batch into one request per message. The requests
+// are not validated yet.
+func (b BatchReq) Requests() []pkg.PostReq {
+	if len(b.Messages) > 0 {
+		return b.Messages
+	}
+
+	reqs := make([]pkg.PostReq, len(b.To))
+	for i, to := range b.To {
+		reqs[i] = pkg.PostReq{From: b.From, FromPool: b.FromPool, To: to, Text: b.Text, TemplateID: b.TemplateID, Variables: b.Variables}
+	}
+	return reqs
+}
+
+// BatchResult is the outcome of one message of a batch.
+type BatchResult struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Code tells apart errors that have one, as in error responses.
+	Code string `json:"code,omitempty"`
+}
+
+// refuse records err as the reason the message was rejected, reporting
+// false when err is not a refusal of the message but a failure to check it.
+func (b *BatchResult) refuse(err error) bool {
+	var se *pkg.StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	b.Error, b.Code = err.Error(), se.Code
+	return true
+}
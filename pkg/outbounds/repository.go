@@ -2,12 +2,19 @@ package outbounds
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/audit"
+	"github.com/olusolaa/go-backend/pkg/conversations"
+	"github.com/olusolaa/go-backend/pkg/destinations"
+	"github.com/olusolaa/go-backend/pkg/events"
+	"github.com/olusolaa/go-backend/pkg/fraud"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
 )
 
 var (
@@ -16,32 +23,324 @@ var (
 
 type Repository interface {
 	post(ctx context.Context, req pkg.PostReq, accountId int64) error
+	ownedNumbers(ctx context.Context, accountId int64, numbers []string) (map[string]bool, error)
+	isStopped(ctx context.Context, req pkg.PostReq) bool
+	checkDestination(ctx context.Context, accountId int64, to string) error
+	takeDestination(ctx context.Context, accountId int64, to string) error
+	screen(ctx context.Context, accountId int64, req pkg.PostReq) (fraud.Verdict, error)
+	hold(ctx context.Context, req pkg.PostReq, accountId int64, v fraud.Verdict) (*Message, error)
+	holdDue(ctx context.Context, id int64, v fraud.Verdict) (bool, error)
+	listHeld(ctx context.Context, accountId int64, limit int) ([]Message, error)
+	findHeld(ctx context.Context, id int64) (*Message, error)
+	review(ctx context.Context, id int64, release bool, clientIP string) (*Message, error)
+	record(ctx context.Context, req pkg.PostReq, accountId int64) (*Message, error)
+	schedule(ctx context.Context, req pkg.PostReq, accountId int64, clientIP string) (*Message, error)
+	cancel(ctx context.Context, id, accountId int64) (bool, error)
+	claimDue(ctx context.Context, lease time.Duration, limit int) ([]Message, error)
+	finish(ctx context.Context, id int64, status string, reason error) (bool, error)
+}
+
+// DestinationChecker refuses messages to countries the account may not
+// send to, or no more today.
+type DestinationChecker interface {
+	Check(ctx context.Context, accountId int64, to string) error
+	Take(ctx context.Context, accountId int64, to string) error
+}
+
+// Screener scores messages for fraud.
+type Screener interface {
+	Screen(ctx context.Context, accountId int64, req pkg.PostReq) (fraud.Verdict, error)
 }
 
 type repository struct {
-	db *sqlx.DB
-	rd *redis.Client
+	db            *sqlx.DB
+	rd            *redis.Client
+	conversations conversations.Repository
+	events        events.Publisher
+	destinations  DestinationChecker
+	screener      Screener
 }
 
 func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
-	return &repository{db: db, rd: rd}
+	return &repository{
+		db:            db,
+		rd:            rd,
+		conversations: conversations.NewRepository(db, rd),
+		events:        events.NewPublisher(rd),
+		destinations:  destinations.NewService(destinations.NewRepository(db, rd)),
+		screener:      fraud.NewService(fraud.NewRepository(db, rd)),
+	}
 }
 
 func (r repository) post(ctx context.Context, req pkg.PostReq, accountId int64) error {
-	var count int
-
-	if _, err := r.rd.Get(fmt.Sprintf("%s:%s", req.From, req.To)).Result(); err == nil {
-		log.Infof("sms from %s to %s blocked by STOP request", req.From, req.To)
+	if r.isStopped(ctx, req) {
 		return errors.Errorf("sms from %s to %s blocked by STOP request", req.From, req.To)
 	}
 
-	if err := r.db.GetContext(ctx, &count, "select count(id) from phone_number where account_id = $1 AND number = $2", accountId, req.From); err != nil {
+	owned, err := r.ownedNumbers(ctx, accountId, []string{req.From})
+	if err != nil {
 		return err
 	}
 
-	if count <= 0 {
+	if !owned[req.From] {
 		return errors.New("from parameter not found")
 	}
-	return nil
+	return r.checkDestination(ctx, accountId, req.To)
+}
+
+// checkDestination refuses messages to countries the destination policy
+// of the account disables, with the error code of the destinations
+// package. It counts nothing, so it runs before the rate limit.
+func (r repository) checkDestination(ctx context.Context, accountId int64, to string) error {
+	return r.destinations.Check(ctx, accountId, to)
+}
+
+// takeDestination counts a message against the daily cap of its country,
+// refusing it once the cap is reached. It is only called for messages
+// about to be sent.
+func (r repository) takeDestination(ctx context.Context, accountId int64, to string) error {
+	return r.destinations.Take(ctx, accountId, to)
+}
+
+// ownedNumbers reports which of numbers belong to the account, in a single
+// query whatever the number of numbers.
+func (r repository) ownedNumbers(ctx context.Context, accountId int64, numbers []string) (map[string]bool, error) {
+	owned := make(map[string]bool, len(numbers))
+	if len(numbers) == 0 {
+		return owned, nil
+	}
+
+	query, args, err := sqlx.In("select number from phone_number where account_id = ? AND number IN (?)", accountId, numbers)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	if err := r.db.SelectContext(ctx, &found, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	for _, n := range found {
+		owned[n] = true
+	}
+	return owned, nil
+}
+
+// screen scores req for fraud. Screening fails open: when the counts
+// behind it cannot be read, the message is let through.
+func (r repository) screen(ctx context.Context, accountId int64, req pkg.PostReq) (fraud.Verdict, error) {
+	v, err := r.screener.Screen(ctx, accountId, req)
+	if err != nil {
+		pkg.Logger(ctx).WithError(err).Error("unable to screen message for fraud")
+		return fraud.Verdict{}, nil
+	}
+	return v, nil
+}
+
+// isStopped reports whether the recipient has sent STOP to the sender.
+func (r repository) isStopped(ctx context.Context, req pkg.PostReq) bool {
+	_, err := r.rd.Get(ctx, fmt.Sprintf("%s:%s", req.From, req.To)).Result()
+	if err == nil {
+		pkg.Logger(ctx).WithFields(pkg.SMSFields(req)).Info("sms blocked by STOP request")
+		return true
+	}
+	return false
+}
 
+// record stores a message that has just been sent in its conversation.
+func (r repository) record(ctx context.Context, req pkg.PostReq, accountId int64) (*Message, error) {
+	convId, err := r.conversations.Attach(ctx, accountId, req.From, req.To, conversations.DirectionOutbound)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Message
+	err = r.db.GetContext(ctx, &m, `INSERT INTO message (account_id, from_number, to_number, text, status, sent_at, template_id, template_version, direction, conversation_id)
+		VALUES ($1, $2, $3, $4, $5, now(), $6, $7, $8, $9) RETURNING *`,
+		accountId, req.From, req.To, req.Text, StatusSent, req.TemplateID, req.TemplateVersion, conversations.DirectionOutbound, convId)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, m)
+	return &m, nil
+}
+
+// hold stores a message held for review in its conversation, with the
+// verdict that held it.
+func (r repository) hold(ctx context.Context, req pkg.PostReq, accountId int64, v fraud.Verdict) (*Message, error) {
+	convId, err := r.conversations.Attach(ctx, accountId, req.From, req.To, conversations.DirectionOutbound)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Message
+	err = r.db.GetContext(ctx, &m, `INSERT INTO message (account_id, from_number, to_number, text, status, error, fraud_score, fraud_signals, template_id, template_version, direction, conversation_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *`,
+		accountId, req.From, req.To, req.Text, StatusHeld, "held for review: "+v.String(), v.Score, strings.Join(v.Signals, ","),
+		req.TemplateID, req.TemplateVersion, conversations.DirectionOutbound, convId)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, m)
+	return &m, nil
+}
+
+// holdDue holds a claimed scheduled message for review instead of sending
+// it. It reports false when the message was cancelled in the meantime.
+func (r repository) holdDue(ctx context.Context, id int64, v fraud.Verdict) (bool, error) {
+	var m Message
+	err := r.db.GetContext(ctx, &m, `UPDATE message SET status = $1, error = $2, fraud_score = $3, fraud_signals = $4, locked_until = NULL
+		WHERE id = $5 AND status = $6 RETURNING *`,
+		StatusHeld, "held for review: "+v.String(), v.Score, strings.Join(v.Signals, ","), id, StatusScheduled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.publish(ctx, m)
+	return true, nil
+}
+
+// listHeld returns the oldest held messages, of every account when
+// accountId is 0.
+func (r repository) listHeld(ctx context.Context, accountId int64, limit int) ([]Message, error) {
+	msgs := []Message{}
+	err := r.db.SelectContext(ctx, &msgs, `SELECT * FROM message WHERE status = $1 AND ($2 = 0 OR account_id = $2)
+		ORDER BY created_at, id LIMIT $3`, StatusHeld, accountId, limit)
+	return msgs, err
+}
+
+// findHeld returns nil when no message with id is held.
+func (r repository) findHeld(ctx context.Context, id int64) (*Message, error) {
+	var m Message
+	err := r.db.GetContext(ctx, &m, `SELECT * FROM message WHERE id = $1 AND status = $2`, id, StatusHeld)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// review sends a held message when release is set, and drops it
+// otherwise, auditing the decision in the same transaction. It returns nil
+// when no message with id is held.
+func (r repository) review(ctx context.Context, id int64, release bool, clientIP string) (*Message, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE message SET status = $1, error = NULL, sent_at = now()
+		WHERE id = $2 AND status = $3 RETURNING *`
+	status, action := StatusSent, ActionRelease
+	if !release {
+		query = `UPDATE message SET status = $1, error = 'dropped on review as suspected fraud'
+			WHERE id = $2 AND status = $3 RETURNING *`
+		status, action = StatusDropped, ActionDrop
+	}
+
+	var m Message
+	err = tx.GetContext(ctx, &m, query, status, id, StatusHeld)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{AccountID: m.AccountID, Action: action, ClientIP: clientIP,
+		Details: audit.Details{"message_id": fmt.Sprint(m.ID)}})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	r.publish(ctx, m)
+	return &m, nil
+}
+
+// schedule stores a scheduled message. It joins its conversation right
+// away, so the thread shows what is still to be sent.
+func (r repository) schedule(ctx context.Context, req pkg.PostReq, accountId int64, clientIP string) (*Message, error) {
+	convId, err := r.conversations.Attach(ctx, accountId, req.From, req.To, conversations.DirectionOutbound)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Message
+	err = r.db.GetContext(ctx, &m, `INSERT INTO message (account_id, from_number, to_number, text, status, client_ip, send_at, template_id, template_version, direction, conversation_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING *`,
+		accountId, req.From, req.To, req.Text, StatusScheduled, clientIP, req.SendAt, req.TemplateID, req.TemplateVersion, conversations.DirectionOutbound, convId)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, m)
+	return &m, nil
+}
+
+// cancel reports false when the account has no scheduled message with id.
+func (r repository) cancel(ctx context.Context, id, accountId int64) (bool, error) {
+	var m Message
+	err := r.db.GetContext(ctx, &m, `UPDATE message SET status = $1, locked_until = NULL
+		WHERE id = $2 AND account_id = $3 AND status = $4 RETURNING *`, StatusCancelled, id, accountId, StatusScheduled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.publish(ctx, m)
+	return true, nil
+}
+
+// claimDue leases up to limit due messages to the caller. Rows locked by
+// another scheduler are skipped, and a lease that runs out without the
+// message being finished makes it claimable again.
+func (r repository) claimDue(ctx context.Context, lease time.Duration, limit int) ([]Message, error) {
+	var msgs []Message
+	err := r.db.SelectContext(ctx, &msgs, `UPDATE message SET locked_until = now() + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM message
+			WHERE status = $2 AND send_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY send_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, lease.Seconds(), StatusScheduled, limit)
+	return msgs, err
+}
+
+// finish records the outcome of a claimed message. It reports false when
+// the message was cancelled in the meantime.
+func (r repository) finish(ctx context.Context, id int64, status string, reason error) (bool, error) {
+	var errMsg *string
+	if reason != nil {
+		s := reason.Error()
+		errMsg = &s
+	}
+
+	var m Message
+	err := r.db.GetContext(ctx, &m, `UPDATE message SET status = $1, error = $2, sent_at = now(), locked_until = NULL
+		WHERE id = $3 AND status = $4 RETURNING *`, status, errMsg, id, StatusScheduled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.publish(ctx, m)
+	return true, nil
+}
+
+// publish pushes the new status of m to the account's streams. The status
+// is stored whether or not it can be pushed.
+func (r repository) publish(ctx context.Context, m Message) {
+	if err := r.events.Publish(ctx, m.AccountID, events.TypeStatus, m.Event()); err != nil {
+		pkg.Logger(ctx).WithError(err).WithField("message_id", m.ID).Error("unable to publish message status")
+	}
 }
@@ -2,20 +2,33 @@ package outbounds
 
 import (
 	"github.com/go-chi/chi"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/templates"
+	"net/http"
 )
 
+// Limiter is the rate limiter applied to outgoing messages. Allow lets a
+// batch consume the limit one message at a time.
+type Limiter interface {
+	Handler(next http.Handler) http.Handler
+	Allow(r *http.Request) (bool, error)
+}
+
 type Resource struct {
-	db *sqlx.DB
-	rd *redis.Client
+	db      *sqlx.DB
+	rd      *redis.Client
+	limiter Limiter
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+func NewResource(db *sqlx.DB, rd *redis.Client, limiter Limiter) *Resource {
 	return &Resource{
-		db: db,
-		rd: rd,
+		db:      db,
+		rd:      rd,
+		limiter: limiter,
 	}
 }
 
@@ -24,10 +37,47 @@ func (rs *Resource) Router() *chi.Mux {
 	r := chi.NewRouter()
 
 	repo := NewRepository(rs.db, rs.rd)
-	svc := NewService(repo)
-	hndlr := NewHandler(svc)
+	svc := NewService(repo,
+		templates.NewService(templates.NewRepository(rs.db, rs.rd)),
+		contacts.NewService(contacts.NewRepository(rs.db, rs.rd)),
+	)
+	hndlr := NewHandler(svc, rs.limiter)
 
-	r.Post("/sms", hndlr.post)
+	r.With(pkg.DecodePostRequest(), rs.limitUnscheduled).Post("/sms", hndlr.post)
+	r.Post("/sms/batch", hndlr.postBatch)
+	r.Delete("/sms/{id}", hndlr.cancel)
 
 	return r
 }
+
+// AdminRouter serves the review of messages held as suspected fraud. It
+// must be mounted behind admin authentication.
+func (rs *Resource) AdminRouter() *chi.Mux {
+	r := chi.NewRouter()
+
+	svc := NewService(NewRepository(rs.db, rs.rd),
+		templates.NewService(templates.NewRepository(rs.db, rs.rd)),
+		contacts.NewService(contacts.NewRepository(rs.db, rs.rd)),
+	)
+	hndlr := NewHandler(svc, rs.limiter)
+
+	r.Get("/held", hndlr.listHeld)
+	r.Post("/held/{id}/release", hndlr.releaseHeld)
+	r.Post("/held/{id}/drop", hndlr.dropHeld)
+
+	return r
+}
+
+// limitUnscheduled rate limits messages sent right away. Scheduled messages
+// are limited when the scheduler releases them, and from_pool messages when
+// their sender is picked.
+func (rs *Resource) limitUnscheduled(next http.Handler) http.Handler {
+	limited := rs.limiter.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req := pkg.GetDecodedPostRequest(r.Context()); req.SendAt != nil || len(req.FromPool) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
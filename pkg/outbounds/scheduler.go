@@ -0,0 +1,95 @@
+package outbounds
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/templates"
+	"net/http"
+	"time"
+)
+
+const (
+	schedulerBatch = 100
+	schedulerLease = time.Minute
+)
+
+// Scheduler releases scheduled messages once they fall due. Messages are
+// leased in the database, so every dyno can run its own Scheduler.
+type Scheduler struct {
+	repo     Repository
+	svc      Service
+	limiter  Limiter
+	interval time.Duration
+}
+
+// NewScheduler creates a scheduler polling for due messages every interval.
+func NewScheduler(db *sqlx.DB, rd *redis.Client, limiter Limiter, interval time.Duration) *Scheduler {
+	repo := NewRepository(db, rd)
+	svc := NewService(repo,
+		templates.NewService(templates.NewRepository(db, rd)),
+		contacts.NewService(contacts.NewRepository(db, rd)),
+	)
+	return &Scheduler{
+		repo:     repo,
+		svc:      svc,
+		limiter:  limiter,
+		interval: interval,
+	}
+}
+
+// Run releases due messages until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.releaseDue(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) releaseDue(ctx context.Context) {
+	log := pkg.Logger(ctx).WithField("context", "outbound_scheduler")
+
+	for {
+		msgs, err := s.repo.claimDue(ctx, schedulerLease, schedulerBatch)
+		if err != nil {
+			log.WithError(err).Error("unable to claim due messages")
+			return
+		}
+
+		for _, msg := range msgs {
+			// limited as if sent directly, from the client address it was
+			// scheduled from
+			if err := s.svc.release(ctx, msg, AllowFrom(ctx, s.limiter, msg.AccountID, msg.ClientIP)); err != nil {
+				log.WithError(err).WithField("message_id", msg.ID).Error("unable to release scheduled message")
+			}
+		}
+
+		if len(msgs) < schedulerBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// AllowFrom checks the rate limit for messages sent outside of an API
+// request the way it would have been checked for a direct send by
+// accountId from clientIP.
+func AllowFrom(ctx context.Context, limiter Limiter, accountId int64, clientIP string) func(pkg.PostReq) (bool, error) {
+	ctx = pkg.WithAccountID(ctx, accountId)
+	return func(req pkg.PostReq) (bool, error) {
+		r, err := http.NewRequestWithContext(pkg.WithPostRequest(ctx, req), http.MethodPost, "/outbound/sms", nil)
+		if err != nil {
+			return false, err
+		}
+		r.RemoteAddr = clientIP
+		return limiter.Allow(r)
+	}
+}
@@ -0,0 +1,46 @@
+package outbounds
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/olusolaa/go-backend/pkg/phone"
+	"sort"
+)
+
+// rankSenders orders the senders of a pool by preference for to. Senders in
+// the recipient's country come first; within that, senders are ranked by
+// rendezvous hashing, so a recipient keeps getting the same sender and
+// changes to the pool only move the recipients of the senders that changed.
+func rankSenders(pool []string, to string) []string {
+	type ranked struct {
+		from   string
+		local  bool
+		weight uint64
+	}
+
+	seen := map[string]bool{}
+	rs := make([]ranked, 0, len(pool))
+	for _, from := range pool {
+		if seen[from] {
+			continue
+		}
+		seen[from] = true
+
+		// numbers differ in few digits, so the hash has to spread them well
+		sum := sha256.Sum256([]byte(from + ":" + to))
+		rs = append(rs, ranked{from: from, local: phone.SameCountry(from, to), weight: binary.BigEndian.Uint64(sum[:8])})
+	}
+
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].local != rs[j].local {
+			return rs[i].local
+		}
+		return rs[i].weight > rs[j].weight
+	})
+
+	senders := make([]string, len(rs))
+	for i, r := range rs {
+		senders[i] = r.from
+	}
+	return senders
+}
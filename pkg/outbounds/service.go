@@ -2,28 +2,543 @@ package outbounds
 
 import (
 	"context"
-	middleware2 "github.com/olusolaa/go-backend/middleware"
 	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/fraud"
+	"github.com/pkg/errors"
+	"net/http"
 )
 
 var _ Service = service{} // Verify that service implements Service.
 
 type Service interface {
-	post(context context.Context, req pkg.PostReq) error
+	post(ctx context.Context, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (*Message, error)
+	postBatch(ctx context.Context, reqs []pkg.PostReq, allow func(pkg.PostReq) (bool, error)) ([]BatchResult, error)
+	postGroup(ctx context.Context, req BatchReq, allow func(pkg.PostReq) (bool, error)) ([]BatchResult, error)
+	schedule(ctx context.Context, req pkg.PostReq, clientIP string) (*Message, error)
+	cancel(ctx context.Context, id int64) error
+	release(ctx context.Context, msg Message, allow func(pkg.PostReq) (bool, error)) error
+	// Send sends req on behalf of an account outside of an API request,
+	// applying the same checks as a direct send, from_pool included. It
+	// fails with ErrStopped or ErrLimited when the message may not be sent
+	// now.
+	Send(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (*Message, error)
+	listHeld(ctx context.Context, accountId int64) ([]HeldMessage, error)
+	releaseHeld(ctx context.Context, id int64, clientIP string) (*HeldMessage, error)
+	dropHeld(ctx context.Context, id int64, clientIP string) (*HeldMessage, error)
+}
+
+var (
+	// ErrStopped is returned for a recipient who sent STOP to the sender.
+	ErrStopped = errors.New("blocked by STOP request")
+	// ErrLimited is returned when the sender has reached its rate limit.
+	ErrLimited = errors.New("limit reached")
+)
+
+// TemplateRenderer renders an account's message template.
+type TemplateRenderer interface {
+	Render(ctx context.Context, accountId, id int64, vars map[string]string) (string, int, error)
+}
+
+// GroupMembers lists the numbers in an account's contact group.
+type GroupMembers interface {
+	Members(ctx context.Context, accountId, groupId int64) ([]string, error)
 }
 
 type service struct {
-	repo Repository
+	repo      Repository
+	templates TemplateRenderer
+	groups    GroupMembers
 }
 
-func NewService(repo Repository) Service {
+func NewService(repo Repository, templates TemplateRenderer, groups GroupMembers) Service {
 	svc := &service{
-		repo: repo,
+		repo:      repo,
+		templates: templates,
+		groups:    groups,
 	}
 	return svc
 }
 
-func (s service) post(ctx context.Context, req pkg.PostReq) error {
-	accountId := middleware2.GetAuthUserId()
-	return s.repo.post(ctx, req, accountId)
+// render fills in the text of a template message and checks it against the
+// same limits as text sent directly.
+func (s service) render(ctx context.Context, req *pkg.PostReq, accountId int64) error {
+	if req.TemplateID == nil {
+		return nil
+	}
+
+	text, version, err := s.templates.Render(ctx, accountId, *req.TemplateID, req.Variables)
+	if err != nil {
+		return err
+	}
+	req.Text = text
+	req.TemplateVersion = &version
+
+	if err := req.Validate(); err != nil {
+		return pkg.WithStatus(http.StatusUnprocessableEntity, errors.Wrap(err, "rendered template"))
+	}
+	return nil
+}
+
+const reasonPoolLimited = "limit reached for every sender in from_pool"
+
+// pickSender picks the sender of a from_pool message: the first sender in
+// rankSenders order that the account owns, that the recipient has not sent
+// STOP to and, when allow is given, that is within its rate limit. When no
+// sender qualifies it returns why as reason.
+func (s service) pickSender(ctx context.Context, req pkg.PostReq, owned map[string]bool, allow func(pkg.PostReq) (bool, error)) (from, reason string, err error) {
+	var stopped, limited bool
+	for _, from := range rankSenders(req.FromPool, req.To) {
+		if !owned[from] {
+			continue
+		}
+
+		req.From = from
+		if s.repo.isStopped(ctx, req) {
+			stopped = true
+			continue
+		}
+		if allow != nil {
+			ok, err := allow(req)
+			if err != nil {
+				return "", "", err
+			}
+			if !ok {
+				limited = true
+				continue
+			}
+		}
+		return from, "", nil
+	}
+
+	switch {
+	case limited:
+		return "", reasonPoolLimited, nil
+	case stopped:
+		return "", ErrStopped.Error(), nil
+	}
+	return "", "from_pool has no number of the account", nil
+}
+
+// post sends req. A from_pool message has its sender picked here, consuming
+// the rate limit through allow, once its destination is known to be
+// allowed; other messages were limited beforehand.
+func (s service) post(ctx context.Context, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (msg *Message, err error) {
+	accountId := pkg.AccountID(ctx)
+
+	ctx, span := pkg.StartSpan(ctx, "outbounds.service.post",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	if err := s.render(ctx, &req, accountId); err != nil {
+		return nil, err
+	}
+	if len(req.FromPool) > 0 {
+		if err := s.repo.checkDestination(ctx, accountId, req.To); err != nil {
+			return nil, err
+		}
+		owned, err := s.repo.ownedNumbers(ctx, accountId, req.FromPool)
+		if err != nil {
+			return nil, err
+		}
+		from, reason, err := s.pickSender(ctx, req, owned, allow)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			return nil, errors.New(reason)
+		}
+		req.From = from
+	}
+	if err := s.repo.post(ctx, req, accountId); err != nil {
+		return nil, err
+	}
+
+	return s.deliver(ctx, req, accountId)
+}
+
+// deliver records req as sent, unless the fraud policy of the account has
+// it held for review or rejected, or the daily cap of its destination is
+// reached. Every path sends through it once the other checks and the rate
+// limit have passed, so only messages that are sent count against the cap.
+func (s service) deliver(ctx context.Context, req pkg.PostReq, accountId int64) (*Message, error) {
+	v, err := s.repo.screen(ctx, accountId, req)
+	if err != nil {
+		return nil, err
+	}
+	switch v.Action {
+	case fraud.ActionReject:
+		return nil, pkg.WithCode(http.StatusForbidden, fraud.CodeSuspected,
+			errors.Errorf("message refused as suspected fraud, %s", v))
+	case fraud.ActionHold:
+		return s.repo.hold(ctx, req, accountId, v)
+	}
+	if err := s.repo.takeDestination(ctx, accountId, req.To); err != nil {
+		return nil, err
+	}
+	return s.repo.record(ctx, req, accountId)
+}
+
+// deliverBatched delivers a message of a batch, recording the outcome in
+// res.
+func (s service) deliverBatched(ctx context.Context, req pkg.PostReq, accountId int64, res *BatchResult) error {
+	msg, err := s.deliver(ctx, req, accountId)
+	if err != nil {
+		if res.refuse(err) {
+			return nil
+		}
+		return err
+	}
+	res.Status = StatusAccepted
+	if msg.Status == StatusHeld {
+		res.Status = StatusHeld
+	}
+	return nil
+}
+
+// postBatch checks every message of a batch on its own, with the same rules
+// as post, and reports which were accepted. allow is asked last so rejected
+// messages do not use up the rate limit.
+func (s service) postBatch(ctx context.Context, reqs []pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (results []BatchResult, err error) {
+	accountId := pkg.AccountID(ctx)
+
+	ctx, span := pkg.StartSpan(ctx, "outbounds.service.postBatch",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	results = make([]BatchResult, len(reqs))
+	valid := make([]bool, len(reqs))
+	var senders []string
+	seen := map[string]bool{}
+
+	for i := range reqs {
+		results[i] = BatchResult{From: reqs[i].From, To: reqs[i].To, Status: StatusRejected}
+		if err := reqs[i].Validate(); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if reqs[i].SendAt != nil {
+			results[i].Error = "send_at is not supported in batches"
+			continue
+		}
+		if err := s.render(ctx, &reqs[i], accountId); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := s.repo.checkDestination(ctx, accountId, reqs[i].To); err != nil {
+			if results[i].refuse(err) {
+				continue
+			}
+			return nil, err
+		}
+		valid[i] = true
+		for _, from := range append([]string{reqs[i].From}, reqs[i].FromPool...) {
+			if from != "" && !seen[from] {
+				seen[from] = true
+				senders = append(senders, from)
+			}
+		}
+	}
+
+	owned, err := s.repo.ownedNumbers(ctx, accountId, senders)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, req := range reqs {
+		if !valid[i] {
+			continue
+		}
+		if len(req.FromPool) > 0 {
+			from, reason, err := s.pickSender(ctx, req, owned, allow)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				results[i].Error = reason
+				continue
+			}
+			req.From = from
+			results[i].From = from
+			if err := s.deliverBatched(ctx, req, accountId, &results[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !owned[req.From] {
+			results[i].Error = "from parameter not found"
+			continue
+		}
+		if s.repo.isStopped(ctx, req) {
+			results[i].Error = ErrStopped.Error()
+			continue
+		}
+
+		ok, err := allow(req)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			results[i].Error = "limit reached for from " + req.From
+			continue
+		}
+		if err := s.deliverBatched(ctx, req, accountId, &results[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// postGroup sends the batch to every member of its contact group. Members
+// who sent STOP to the sender are skipped rather than rejected: they are
+// expected in a group and are not a fault of the request.
+func (s service) postGroup(ctx context.Context, req BatchReq, allow func(pkg.PostReq) (bool, error)) ([]BatchResult, error) {
+	numbers, err := s.groups.Members(ctx, pkg.AccountID(ctx), *req.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	req.To, req.GroupID = numbers, nil
+	results, err := s.postBatch(ctx, req.Requests(), allow)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if results[i].Error == ErrStopped.Error() {
+			results[i].Status = StatusSkipped
+		}
+	}
+	return results, nil
+}
+
+// schedule stores req to be sent at req.SendAt. Only the sender is checked
+// now; STOP and the rate limit are checked by release when it falls due.
+func (s service) schedule(ctx context.Context, req pkg.PostReq, clientIP string) (msg *Message, err error) {
+	accountId := pkg.AccountID(ctx)
+
+	ctx, span := pkg.StartSpan(ctx, "outbounds.service.schedule",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	if err := s.render(ctx, &req, accountId); err != nil {
+		return nil, err
+	}
+
+	owned, err := s.repo.ownedNumbers(ctx, accountId, append([]string{req.From}, req.FromPool...))
+	if err != nil {
+		return nil, err
+	}
+	if len(req.FromPool) > 0 {
+		// picked now so the recipient keeps its sender; the rate limit is
+		// applied on release
+		from, reason, err := s.pickSender(ctx, req, owned, nil)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			return nil, errors.New(reason)
+		}
+		req.From = from
+	}
+	if !owned[req.From] {
+		return nil, errors.New("from parameter not found")
+	}
+
+	return s.repo.schedule(ctx, req, accountId, clientIP)
+}
+
+func (s service) cancel(ctx context.Context, id int64) error {
+	ok, err := s.repo.cancel(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no scheduled message with id %d", id))
+	}
+	return nil
+}
+
+// release sends a message that fell due, applying the same checks as post
+// as they stand now rather than when the message was scheduled.
+func (s service) release(ctx context.Context, msg Message, allow func(pkg.PostReq) (bool, error)) (err error) {
+	ctx, span := pkg.StartSpan(ctx, "outbounds.service.release",
+		pkg.AttrAccountID.Int64(msg.AccountID),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	req := msg.PostReq()
+	status := StatusSent
+	reason := s.repo.post(ctx, req, msg.AccountID)
+	if reason == nil {
+		ok, err := allow(req)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			reason = errors.Errorf("limit reached for from %s", req.From)
+		}
+	}
+	if reason == nil {
+		v, err := s.repo.screen(ctx, msg.AccountID, req)
+		if err != nil {
+			return err
+		}
+		switch v.Action {
+		case fraud.ActionReject:
+			reason = errors.Errorf("message refused as suspected fraud, %s", v)
+		case fraud.ActionHold:
+			ok, err := s.repo.holdDue(ctx, msg.ID, v)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				pkg.Logger(ctx).WithField("message_id", msg.ID).Info("scheduled message cancelled before release")
+			}
+			return nil
+		default:
+			// last, as in deliver, so only messages that are sent count
+			// against the daily cap
+			reason = s.repo.takeDestination(ctx, msg.AccountID, req.To)
+		}
+	}
+	if reason != nil {
+		status = StatusFailed
+	}
+
+	ok, err := s.repo.finish(ctx, msg.ID, status, reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		pkg.Logger(ctx).WithField("message_id", msg.ID).Info("scheduled message cancelled before release")
+	}
+	return nil
+}
+
+func (s service) Send(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (msg *Message, err error) {
+	ctx, span := pkg.StartSpan(ctx, "outbounds.service.Send",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("outbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	if err := req.Validate(); err != nil {
+		return nil, pkg.WithStatus(http.StatusUnprocessableEntity, err)
+	}
+	if err := s.render(ctx, &req, accountId); err != nil {
+		return nil, err
+	}
+	if err := s.repo.checkDestination(ctx, accountId, req.To); err != nil {
+		return nil, err
+	}
+	if len(req.FromPool) > 0 {
+		owned, err := s.repo.ownedNumbers(ctx, accountId, req.FromPool)
+		if err != nil {
+			return nil, err
+		}
+		from, reason, err := s.pickSender(ctx, req, owned, allow)
+		if err != nil {
+			return nil, err
+		}
+		switch reason {
+		case "":
+		case ErrStopped.Error():
+			return nil, ErrStopped
+		case reasonPoolLimited:
+			return nil, ErrLimited
+		default:
+			return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.New(reason))
+		}
+		req.From = from
+		return s.deliver(ctx, req, accountId)
+	}
+
+	if s.repo.isStopped(ctx, req) {
+		return nil, ErrStopped
+	}
+
+	owned, err := s.repo.ownedNumbers(ctx, accountId, []string{req.From})
+	if err != nil {
+		return nil, err
+	}
+	if !owned[req.From] {
+		return nil, pkg.WithStatus(http.StatusUnprocessableEntity, errors.New("from parameter not found"))
+	}
+
+	ok, err := allow(req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLimited
+	}
+	return s.deliver(ctx, req, accountId)
+}
+
+// heldLimit is how many held messages are listed at once.
+const heldLimit = 100
+
+func heldNotFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no held message with id %d", id))
+}
+
+// listHeld lists the held messages of the account, or of every account
+// when accountId is 0, oldest first.
+func (s service) listHeld(ctx context.Context, accountId int64) ([]HeldMessage, error) {
+	msgs, err := s.repo.listHeld(ctx, accountId, heldLimit)
+	if err != nil {
+		return nil, err
+	}
+	held := make([]HeldMessage, len(msgs))
+	for i, m := range msgs {
+		held[i] = m.held()
+	}
+	return held, nil
+}
+
+// releaseHeld sends a held message. Its rate limits were counted when it
+// was held, but a STOP received since still blocks it, and it only counts
+// against the daily cap of its destination now that it is sent.
+func (s service) releaseHeld(ctx context.Context, id int64, clientIP string) (*HeldMessage, error) {
+	msg, err := s.repo.findHeld(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, heldNotFound(id)
+	}
+	if s.repo.isStopped(ctx, msg.PostReq()) {
+		return nil, pkg.WithStatus(http.StatusConflict,
+			errors.Errorf("the recipient of message %d sent STOP since it was held, drop it instead", id))
+	}
+	if err := s.repo.takeDestination(ctx, msg.AccountID, msg.To); err != nil {
+		return nil, err
+	}
+	return s.review(ctx, id, true, clientIP)
+}
+
+func (s service) dropHeld(ctx context.Context, id int64, clientIP string) (*HeldMessage, error) {
+	return s.review(ctx, id, false, clientIP)
+}
+
+func (s service) review(ctx context.Context, id int64, release bool, clientIP string) (*HeldMessage, error) {
+	msg, err := s.repo.review(ctx, id, release, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, heldNotFound(id)
+	}
+	pkg.Logger(ctx).WithField("message_id", msg.ID).WithField("account_id", msg.AccountID).
+		WithField("status", msg.Status).Info("held message reviewed")
+	held := msg.held()
+	return &held, nil
 }
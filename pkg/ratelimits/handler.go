@@ -0,0 +1,81 @@
+package ratelimits
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// scope resolves the account or sender of the route.
+func (h Handler) scope(r *http.Request) (Scope, error) {
+	if from := chi.URLParam(r, "from"); from != "" {
+		return h.svc.senderScope(r.Context(), from)
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return Scope{}, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid account id"))
+	}
+	return h.svc.accountScope(r.Context(), id)
+}
+
+func (h Handler) usage(w http.ResponseWriter, r *http.Request) {
+	sc, err := h.scope(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	u, err := h.svc.usage(r.Context(), sc)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, u)
+}
+
+// reset clears the window named by ?window=, or every window of the scope.
+func (h Handler) reset(w http.ResponseWriter, r *http.Request) {
+	sc, err := h.scope(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.reset(r.Context(), sc, r.URL.Query().Get("window")); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "rate limits reset")
+}
+
+func (h Handler) boost(w http.ResponseWriter, r *http.Request) {
+	sc, err := h.scope(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req BoostReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.boost(r.Context(), sc, req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "rate limit boosted")
+}
@@ -0,0 +1,49 @@
+package ratelimits
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"net/http"
+	"time"
+)
+
+// maxBoostDuration bounds how long a boost may last; anything longer is a
+// plan change.
+const maxBoostDuration = 30 * 24 * time.Hour
+
+// Scope is what limits are kept for: an account, or one of its senders.
+type Scope struct {
+	AccountID int64  `json:"account_id"`
+	From      string `json:"from,omitempty"`
+}
+
+// Usage is where a scope stands in the windows of its account's plan.
+type Usage struct {
+	Scope
+	Plan    string              `json:"plan"`
+	Windows []middleware2.Usage `json:"windows"`
+}
+
+// BoostReq adds Extra to the limit of one window until ExpiresAt. An
+// Extra of 0 withdraws the boost.
+type BoostReq struct {
+	Window    string    `json:"window"`
+	Extra     int       `json:"extra"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (v *BoostReq) Bind(r *http.Request) error {
+	now := time.Now()
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "window", Field: v.Window, Message: fmt.Sprintf("%s is missing", "window")},
+		&validators.IntIsGreaterThan{Name: "extra", Field: v.Extra, Compared: -1, Message: fmt.Sprintf("%s is invalid", "extra")},
+		&validators.TimeAfterTime{FirstName: "expires_at", FirstTime: v.ExpiresAt, SecondName: "now", SecondTime: now, Message: fmt.Sprintf("%s must be in the future", "expires_at")},
+		&validators.TimeAfterTime{FirstName: "max", FirstTime: now.Add(maxBoostDuration), SecondName: "expires_at", SecondTime: v.ExpiresAt, Message: fmt.Sprintf("%s must be within %d days", "expires_at", int(maxBoostDuration.Hours()/24))},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package ratelimits
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	accountExists(ctx context.Context, accountId int64) (bool, error)
+	ownerOf(ctx context.Context, number string) (int64, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r repository) accountExists(ctx context.Context, accountId int64) (bool, error) {
+	var ok bool
+	err := r.db.GetContext(ctx, &ok, `SELECT EXISTS (SELECT 1 FROM account WHERE id = $1)`, accountId)
+	return ok, err
+}
+
+// ownerOf returns the account owning number, or 0.
+func (r repository) ownerOf(ctx context.Context, number string) (int64, error) {
+	var id int64
+	err := r.db.GetContext(ctx, &id, `SELECT account_id FROM phone_number WHERE number = $1`, number)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
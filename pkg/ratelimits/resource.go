@@ -0,0 +1,41 @@
+package ratelimits
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg/account"
+)
+
+type Resource struct {
+	db      *sqlx.DB
+	rd      *redis.Client
+	limiter Limiter
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client, limiter Limiter) *Resource {
+	return &Resource{
+		db:      db,
+		rd:      rd,
+		limiter: limiter,
+	}
+}
+
+// Router serves the admin routes for the limits of accounts and of their
+// sender numbers. It must be mounted behind admin authentication.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	svc := NewService(NewRepository(rs.db), account.NewRepository(rs.db, rs.rd), rs.limiter)
+	hndlr := NewHandler(svc)
+
+	r.Get("/accounts/{id}", hndlr.usage)
+	r.Delete("/accounts/{id}", hndlr.reset)
+	r.Post("/accounts/{id}/boosts", hndlr.boost)
+	r.Get("/senders/{from}", hndlr.usage)
+	r.Delete("/senders/{from}", hndlr.reset)
+	r.Post("/senders/{from}/boosts", hndlr.boost)
+
+	return r
+}
@@ -0,0 +1,172 @@
+package ratelimits
+
+import (
+	"context"
+	middleware2 "github.com/olusolaa/go-backend/middleware"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+// Limiter is the plan limiter the admin routes inspect.
+type Limiter interface {
+	Usage(r *http.Request, names ...string) ([]middleware2.Usage, error)
+	Reset(r *http.Request, names ...string) error
+	Boost(r *http.Request, name string, extra int, until time.Time) error
+}
+
+type Service interface {
+	accountScope(ctx context.Context, accountId int64) (Scope, error)
+	senderScope(ctx context.Context, from string) (Scope, error)
+	usage(ctx context.Context, sc Scope) (*Usage, error)
+	reset(ctx context.Context, sc Scope, window string) error
+	boost(ctx context.Context, sc Scope, req BoostReq) error
+}
+
+type service struct {
+	repo     Repository
+	accounts account.Repository
+	limiter  Limiter
+}
+
+func NewService(repo Repository, accounts account.Repository, limiter Limiter) Service {
+	svc := &service{
+		repo:     repo,
+		accounts: accounts,
+		limiter:  limiter,
+	}
+	return svc
+}
+
+func (s service) accountScope(ctx context.Context, accountId int64) (Scope, error) {
+	ok, err := s.repo.accountExists(ctx, accountId)
+	if err != nil {
+		return Scope{}, err
+	}
+	if !ok {
+		return Scope{}, pkg.WithStatus(http.StatusNotFound, errors.Errorf("no account with id %d", accountId))
+	}
+	return Scope{AccountID: accountId}, nil
+}
+
+func (s service) senderScope(ctx context.Context, from string) (Scope, error) {
+	accountId, err := s.repo.ownerOf(ctx, from)
+	if err != nil {
+		return Scope{}, err
+	}
+	if accountId == 0 {
+		return Scope{}, pkg.WithStatus(http.StatusNotFound, errors.Errorf("no account owns %s", from))
+	}
+	return Scope{AccountID: accountId, From: from}, nil
+}
+
+// windows returns the plan windows of sc.
+func windows(sc Scope) []string {
+	if sc.From != "" {
+		return middleware2.SenderWindows
+	}
+	return middleware2.AccountWindows
+}
+
+// checkWindow checks that name is one of the windows of sc.
+func checkWindow(sc Scope, name string) error {
+	for _, w := range windows(sc) {
+		if w == name {
+			return nil
+		}
+	}
+	return pkg.WithStatus(http.StatusUnprocessableEntity,
+		errors.Errorf("window must be one of %s", strings.Join(windows(sc), ", ")))
+}
+
+// request is the request the limiter would see for a message of sc.
+func request(ctx context.Context, sc Scope) (*http.Request, error) {
+	ctx = pkg.WithPostRequest(pkg.WithAccountID(ctx, sc.AccountID), pkg.PostReq{From: sc.From})
+	return http.NewRequestWithContext(ctx, http.MethodPost, "/outbound/sms", nil)
+}
+
+func logFields(sc Scope) logrus.Fields {
+	return logrus.Fields{"account_id": sc.AccountID, "from": sc.From}
+}
+
+func (s service) usage(ctx context.Context, sc Scope) (*Usage, error) {
+	plan, err := s.accounts.FindPlan(ctx, sc.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := request(ctx, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := s.limiter.Usage(r, windows(sc)...)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		ws = []middleware2.Usage{}
+	}
+	return &Usage{Scope: sc, Plan: plan.Name, Windows: ws}, nil
+}
+
+// reset forgets the messages counted for sc in window, or in all of its
+// windows when window is empty.
+func (s service) reset(ctx context.Context, sc Scope, window string) error {
+	names := windows(sc)
+	if window != "" {
+		if err := checkWindow(sc, window); err != nil {
+			return err
+		}
+		names = []string{window}
+	}
+
+	r, err := request(ctx, sc)
+	if err != nil {
+		return err
+	}
+	if err := s.limiter.Reset(r, names...); err != nil {
+		return limiterError(err)
+	}
+
+	pkg.Logger(ctx).WithFields(logFields(sc)).WithField("windows", names).Info("rate limits reset")
+	return nil
+}
+
+func (s service) boost(ctx context.Context, sc Scope, req BoostReq) error {
+	if err := checkWindow(sc, req.Window); err != nil {
+		return err
+	}
+
+	r, err := request(ctx, sc)
+	if err != nil {
+		return err
+	}
+	if err := s.limiter.Boost(r, req.Window, req.Extra, req.ExpiresAt); err != nil {
+		return limiterError(err)
+	}
+
+	pkg.Logger(ctx).WithFields(logFields(sc)).WithFields(logrus.Fields{
+		"window":     req.Window,
+		"extra":      req.Extra,
+		"expires_at": req.ExpiresAt,
+	}).Info("rate limit boosted")
+	return nil
+}
+
+// limiterError maps the limiter features this deployment lacks to 501, and
+// boosts of windows without a limit to 422.
+func limiterError(err error) error {
+	if errors.Is(err, middleware2.ErrNoBoosts) || errors.Is(err, middleware2.ErrNoReset) {
+		return pkg.WithStatus(http.StatusNotImplemented, err)
+	}
+	if errors.Is(err, middleware2.ErrUnlimited) {
+		return pkg.WithStatus(http.StatusUnprocessableEntity, err)
+	}
+	return err
+}
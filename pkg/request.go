@@ -1,29 +1,100 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-chi/render"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// scheduleSkew is how far in the past send_at may be, to allow for clock
+// differences with the client.
+const scheduleSkew = time.Minute
+
+var scheduleHorizon = 7 * 24 * time.Hour
+
+// MaxFromPool bounds the senders of a from_pool.
+const MaxFromPool = 20
+
+// SetScheduleHorizon sets how far ahead send_at may be. It is meant to be
+// called once at startup.
+func SetScheduleHorizon(d time.Duration) {
+	scheduleHorizon = d
+}
+
 type PostReq struct {
 	From string `json:"from" min:"6" max:"16"`
-	To   string `json:"to" min:"6" max:"16"`
-	Text string `json:"text" min:"1" max:"160"`
+	// FromPool, instead of From, lets the service pick the sender.
+	FromPool []string `json:"from_pool,omitempty"`
+	To       string   `json:"to" min:"6" max:"16"`
+	Text     string   `json:"text" min:"1" max:"160"`
+	// SendAt, when set, holds the message back until then.
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// TemplateID and Variables replace Text with a rendered template.
+	TemplateID *int64            `json:"template_id,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	// TemplateVersion is the version TemplateID was rendered from.
+	TemplateVersion *int `json:"-"`
 }
 
 func (v *PostReq) Bind(r *http.Request) error {
-	err1 := validate.Validate(
-		&validators.StringIsPresent{Name: "from", Field: v.From, Message: fmt.Sprintf("%s is missing", "from")},
+	if v.TemplateID != nil && v.Text != "" {
+		return fmt.Errorf("send either text or template_id, not both")
+	}
+	return v.Validate()
+}
+
+// Validate checks the message against the sms limits and normalises its
+// text. Every way of submitting a message goes through it, and template
+// messages go through it again once rendered.
+func (v *PostReq) Validate() error {
+	checks := []validate.Validator{
 		&validators.StringIsPresent{Name: "to", Field: v.To, Message: fmt.Sprintf("%s is missing", "to")},
-		&validators.StringIsPresent{Name: "text", Field: v.Text, Message: fmt.Sprintf("%s is missing", "text")},
-		&validators.StringLengthInRange{Name: "from", Field: v.From, Min: 6, Max: 16, Message: fmt.Sprintf("%s is invalid", "from")},
 		&validators.StringLengthInRange{Name: "to", Field: v.To, Min: 6, Max: 16, Message: fmt.Sprintf("%s is invalid", "to")},
-		&validators.StringLengthInRange{Name: "text", Field: v.Text, Min: 1, Max: 160, Message: fmt.Sprintf("%s is invalid", "text")},
-	)
+	}
+	// the sender of a pool message is only known once it is picked
+	if len(v.FromPool) == 0 || v.From != "" {
+		checks = append(checks,
+			&validators.StringIsPresent{Name: "from", Field: v.From, Message: fmt.Sprintf("%s is missing", "from")},
+			&validators.StringLengthInRange{Name: "from", Field: v.From, Min: 6, Max: 16, Message: fmt.Sprintf("%s is invalid", "from")},
+		)
+	}
+	for _, from := range v.FromPool {
+		checks = append(checks, &validators.StringLengthInRange{Name: "from_pool", Field: from, Min: 6, Max: 16, Message: fmt.Sprintf("%s is invalid", "from_pool")})
+	}
+	// a template message has no text until it is rendered
+	if v.TemplateID == nil || v.Text != "" {
+		checks = append(checks,
+			&validators.StringIsPresent{Name: "text", Field: v.Text, Message: fmt.Sprintf("%s is missing", "text")},
+			&validators.StringLengthInRange{Name: "text", Field: v.Text, Min: 1, Max: MaxGSM7Length, Message: fmt.Sprintf("%s is invalid", "text")},
+		)
+	}
+	err1 := validate.Validate(checks...)
+	if v.From != "" && len(v.FromPool) > 0 {
+		err1.Add("from_pool", "send either from or from_pool, not both")
+	}
+	if len(v.FromPool) > MaxFromPool {
+		err1.Add("from_pool", fmt.Sprintf("from_pool may hold at most %d numbers", MaxFromPool))
+	}
+
+	if length, gsm7 := SMSLength(v.Text); gsm7 && length > MaxGSM7Length {
+		err1.Add("text", "text is too long once special characters are counted twice")
+	} else if !gsm7 && length > MaxUCS2Length {
+		err1.Add("text", fmt.Sprintf("text may be at most %d characters when it uses characters outside the GSM alphabet", MaxUCS2Length))
+	}
+
+	if v.SendAt != nil {
+		now := time.Now()
+		if v.SendAt.Before(now.Add(-scheduleSkew)) {
+			err1.Add("send_at", "send_at is in the past")
+		} else if v.SendAt.After(now.Add(scheduleHorizon)) {
+			err1.Add("send_at", fmt.Sprintf("send_at is more than %s ahead", scheduleHorizon))
+		}
+	}
 
 	v.Text = strings.TrimSpace(strings.ToLower(v.Text))
 	if err1.HasAny() {
@@ -32,7 +103,26 @@ func (v *PostReq) Bind(r *http.Request) error {
 	return nil
 }
 
-var postRequest PostReq
+type postReqCtxKey struct{}
+
+type accountIDCtxKey struct{}
+
+// WithAccountID returns a copy of ctx carrying the ID of the account a
+// request is made for.
+func WithAccountID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, accountIDCtxKey{}, id)
+}
+
+// AccountID returns the ID stored by WithAccountID, or 0.
+func AccountID(ctx context.Context) int64 {
+	id, _ := ctx.Value(accountIDCtxKey{}).(int64)
+	return id
+}
+
+// WithPostRequest returns a copy of ctx carrying req.
+func WithPostRequest(ctx context.Context, req PostReq) context.Context {
+	return context.WithValue(ctx, postReqCtxKey{}, req)
+}
 
 func DecodePostRequest() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -42,12 +132,13 @@ func DecodePostRequest() func(http.Handler) http.Handler {
 				Render(w, r, err)
 				return
 			}
-			postRequest = req
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(WithPostRequest(r.Context(), req)))
 		})
 	}
 }
 
-func GetDecodedPostRequest() PostReq {
-	return postRequest
+// GetDecodedPostRequest returns the request decoded by DecodePostRequest.
+func GetDecodedPostRequest(ctx context.Context) PostReq {
+	req, _ := ctx.Value(postReqCtxKey{}).(PostReq)
+	return req
 }
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+)
+
+// accountID returns the account authenticated for the call.
+func accountID(ctx context.Context) int64 {
+	return pkg.AccountID(ctx)
+}
+
+var errUnauthenticated = status.Error(codes.Unauthenticated, "unauthorized")
+
+// authenticator checks the basic credentials of the "authorization"
+// metadata against the account they name, as middleware.BasicAuth does
+// for the REST API, and the caller's address against the account's
+// allowlist as middleware.IPAllowlist does.
+type authenticator struct {
+	findByUsername func(context.Context, string) (*account.Account, error)
+	allows         func(ctx context.Context, accountId int64, ip string) (bool, error)
+}
+
+func (a authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	log := logrus.WithField("method", method)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, errUnauthenticated
+	}
+
+	// parsed as the REST API parses its Authorization header
+	r := http.Request{Header: http.Header{"Authorization": values[:1]}}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	acc, err := a.findByUsername(ctx, user)
+	if err != nil {
+		log.WithError(err).Warn("basic auth: account lookup failed")
+		return nil, errUnauthenticated
+	}
+	if acc.AuthId != pass {
+		log.WithField("account_id", acc.ID).Warn("basic auth: invalid credentials")
+		return nil, errUnauthenticated
+	}
+
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+	allowed, err := a.allows(ctx, acc.ID, clientIP)
+	if err != nil {
+		log.WithError(err).Error("ip allowlist: lookup failed")
+		return nil, status.Error(codes.Internal, "ip allowlist lookup failed")
+	}
+	if !allowed {
+		log.WithField("account_id", acc.ID).WithField("client_ip", clientIP).Warn("ip allowlist: address not allowed")
+		return nil, status.Errorf(codes.PermissionDenied, "address %s is not on the account's allowlist", clientIP)
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(pkg.AttrAccountID.Int64(acc.ID))
+	ctx = pkg.WithLogger(ctx, log.WithField("account_id", acc.ID))
+	return pkg.WithAccountID(ctx, acc.ID), nil
+}
+
+func (a authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,7 @@
+// Package rpc serves the SMS API over gRPC for internal services. The API
+// is described by proto/sms/v1/sms.proto; smsv1 is generated from it with
+// protoc-gen-go v1.28.0 and protoc-gen-go-grpc v1.2.0, the versions that
+// match the protobuf and grpc modules in go.mod.
+package rpc
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/olusolaa/go-backend --go-grpc_out=../.. --go-grpc_opt=module=github.com/olusolaa/go-backend sms/v1/sms.proto
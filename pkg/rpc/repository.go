@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg/events"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	findMessage(ctx context.Context, id, accountId int64) (*events.Message, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) Repository {
+	return &repository{db: db}
+}
+
+// findMessage returns nil when the account has no such message.
+func (r repository) findMessage(ctx context.Context, id, accountId int64) (*events.Message, error) {
+	var m events.Message
+	err := r.db.GetContext(ctx, &m, `SELECT * FROM message WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/gobuffalo/validate"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/account"
+	"github.com/olusolaa/go-backend/pkg/allowlist"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/events"
+	"github.com/olusolaa/go-backend/pkg/inbounds"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/rpc/smsv1"
+	"github.com/olusolaa/go-backend/pkg/templates"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/http"
+	"time"
+)
+
+// Hub is where StreamInbound gets the account's events from.
+type Hub interface {
+	Subscribe(accountId int64) (*events.Subscription, error)
+	Since(ctx context.Context, accountId int64, lastID string) ([]events.Event, error)
+}
+
+type server struct {
+	smsv1.UnimplementedSMSServiceServer
+
+	repo     Repository
+	inbound  inbounds.Service
+	outbound outbounds.Service
+	limiter  outbounds.Limiter
+	hub      Hub
+}
+
+// NewServer returns the gRPC API. It sends and receives through the same
+// services as the REST API, and counts messages against the same limiter.
+func NewServer(db *sqlx.DB, rd *redis.Client, limiter outbounds.Limiter, hub Hub) *grpc.Server {
+	auth := authenticator{
+		findByUsername: account.NewRepository(db, rd).FindByUsername,
+		allows:         allowlist.NewService(allowlist.NewRepository(db, rd)).Allows,
+	}
+
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(auth.unary),
+		grpc.StreamInterceptor(auth.stream),
+		// keeps idle streams open through proxies
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: time.Minute}),
+	)
+	smsv1.RegisterSMSServiceServer(s, &server{
+		repo:    NewRepository(db),
+		inbound: inbounds.NewDefaultService(db, rd),
+		outbound: outbounds.NewService(outbounds.NewRepository(db, rd),
+			templates.NewService(templates.NewRepository(db, rd)),
+			contacts.NewService(contacts.NewRepository(db, rd)),
+		),
+		limiter: limiter,
+		hub:     hub,
+	})
+	return s
+}
+
+// allow checks the rate limit as for a REST call from the same address.
+func (s server) allow(ctx context.Context) func(pkg.PostReq) (bool, error) {
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP = p.Addr.String()
+	}
+	return outbounds.AllowFrom(ctx, s.limiter, accountID(ctx), clientIP)
+}
+
+func (s server) SendSMS(ctx context.Context, in *smsv1.SendSMSRequest) (*smsv1.Message, error) {
+	req := pkg.PostReq{From: in.From, To: in.To, Text: in.Text, FromPool: in.FromPool}
+
+	msg, err := s.outbound.Send(ctx, accountID(ctx), req, s.allow(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toMessage(msg.Event()), nil
+}
+
+func (s server) ReceiveSMS(ctx context.Context, in *smsv1.ReceiveSMSRequest) (*smsv1.ReceiveSMSResponse, error) {
+	req := pkg.PostReq{From: in.From, To: in.To, Text: in.Text}
+	if err := req.Validate(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	// inbound messages are limited on arrival, as on POST /inbound/sms
+	allow := s.allow(ctx)
+	ok, err := allow(req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if !ok {
+		return nil, status.Errorf(codes.ResourceExhausted, "limit reached for from %s", req.From)
+	}
+
+	if err := s.inbound.Receive(ctx, accountID(ctx), req, allow); err != nil {
+		return nil, toStatus(err)
+	}
+	return &smsv1.ReceiveSMSResponse{}, nil
+}
+
+func (s server) GetMessage(ctx context.Context, in *smsv1.GetMessageRequest) (*smsv1.Message, error) {
+	msg, err := s.repo.findMessage(ctx, in.Id, accountID(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if msg == nil {
+		return nil, status.Errorf(codes.NotFound, "no message with id %d", in.Id)
+	}
+	return toMessage(*msg), nil
+}
+
+// StreamInbound sends the inbound events of the account until the client
+// leaves or the server stops, resuming after in.LastEventId when set.
+func (s server) StreamInbound(in *smsv1.StreamInboundRequest, stream smsv1.SMSService_StreamInboundServer) error {
+	ctx := stream.Context()
+	accountId := accountID(ctx)
+
+	lastID := in.LastEventId
+	if lastID != "" {
+		if err := events.ParseID(lastID); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	// subscribe before reading the backlog so no event falls in between
+	sub, err := s.hub.Subscribe(accountId)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer sub.Close()
+
+	send := func(e events.Event) error {
+		lastID = e.ID
+		if e.Type != events.TypeInbound {
+			return nil
+		}
+		ev, err := toInboundEvent(e)
+		if err != nil {
+			return err
+		}
+		return stream.Send(ev)
+	}
+
+	if lastID != "" {
+		backlog, err := s.hub.Since(ctx, accountId, lastID)
+		if err != nil {
+			return toStatus(err)
+		}
+		for _, e := range backlog {
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed, resume from the last event")
+			}
+			if lastID != "" && !events.After(e.ID, lastID) {
+				// already sent with the backlog
+				continue
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toStatus maps the errors of the services to gRPC statuses, the way
+// pkg.Render maps them to HTTP statuses.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var se *pkg.StatusError
+	var ve *validate.Errors
+	switch {
+	case errors.As(err, &ve):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, outbounds.ErrStopped):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, outbounds.ErrLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &se):
+		return status.Error(codeOf(se.Status), err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func codeOf(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+func toMessage(m events.Message) *smsv1.Message {
+	msg := &smsv1.Message{
+		Id:        m.ID,
+		Direction: m.Direction,
+		From:      m.From,
+		To:        m.To,
+		Text:      m.Text,
+		Status:    m.Status,
+		CreatedAt: timestamppb.New(m.CreatedAt),
+	}
+	if m.ConversationID != nil {
+		msg.ConversationId = *m.ConversationID
+	}
+	if m.Error != nil {
+		msg.Error = *m.Error
+	}
+	if m.SendAt != nil {
+		msg.SendAt = timestamppb.New(*m.SendAt)
+	}
+	if m.SentAt != nil {
+		msg.SentAt = timestamppb.New(*m.SentAt)
+	}
+	return msg
+}
+
+func toInboundEvent(e events.Event) (*smsv1.InboundEvent, error) {
+	var m events.Message
+	if err := json.Unmarshal(e.Data, &m); err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("event %s: %s", e.ID, err))
+	}
+	return &smsv1.InboundEvent{Id: e.ID, Message: toMessage(m)}, nil
+}
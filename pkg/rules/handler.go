@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func ruleID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, pkg.WithStatus(http.StatusBadRequest, errors.New("invalid rule id"))
+	}
+	return id, nil
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req RuleReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	rule, err := h.svc.create(r.Context(), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, rule)
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.list(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, rules)
+}
+
+func (h Handler) update(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	var req RuleReq
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	rule, err := h.svc.update(r.Context(), id, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, rule)
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.delete(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	pkg.Render(w, r, "rule deleted")
+}
@@ -0,0 +1,126 @@
+package rules
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/olusolaa/go-backend/pkg"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Match types.
+const (
+	MatchKeyword = "keyword"
+	MatchRegex   = "regex"
+)
+
+const (
+	defaultMaxReplies = 1
+	defaultWindow     = time.Hour
+	maxWindow         = 7 * 24 * time.Hour
+)
+
+// Rule replies to inbound messages to Number whose text matches Pattern.
+// Texts are matched once lowercased and trimmed, as they are stored.
+type Rule struct {
+	ID        int64   `json:"id" db:"id"`
+	AccountID int64   `json:"-" db:"account_id"`
+	Number    string  `json:"number" db:"number"`
+	Name      string  `json:"name" db:"name"`
+	MatchType string  `json:"match_type" db:"match_type"`
+	Pattern   string  `json:"pattern" db:"pattern"`
+	Reply     string  `json:"reply" db:"reply"`
+	Tag       *string `json:"tag,omitempty" db:"tag"`
+	Priority  int     `json:"priority" db:"priority"`
+	// MaxReplies is how many times the rule may reply to one remote number
+	// within WindowSeconds, so two auto-responders cannot loop.
+	MaxReplies    int       `json:"max_replies" db:"max_replies"`
+	WindowSeconds int       `json:"window_seconds" db:"window_seconds"`
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// matches reports whether text, lowercased and trimmed, triggers the rule.
+// A keyword matches a text that is the keyword or starts with it as a word.
+func (r Rule) matches(text string) bool {
+	switch r.MatchType {
+	case MatchKeyword:
+		keyword := strings.ToLower(r.Pattern)
+		return text == keyword || strings.HasPrefix(text, keyword+" ")
+	case MatchRegex:
+		re, err := regexp.Compile(r.Pattern)
+		return err == nil && re.MatchString(text)
+	}
+	return false
+}
+
+// RuleReq creates or replaces a rule.
+type RuleReq struct {
+	Number        string  `json:"number"`
+	Name          string  `json:"name"`
+	MatchType     string  `json:"match_type"`
+	Pattern       string  `json:"pattern"`
+	Reply         string  `json:"reply"`
+	Tag           *string `json:"tag,omitempty"`
+	Priority      int     `json:"priority"`
+	MaxReplies    int     `json:"max_replies"`
+	WindowSeconds int     `json:"window_seconds"`
+	Enabled       *bool   `json:"enabled,omitempty"`
+}
+
+func (v *RuleReq) Bind(r *http.Request) error {
+	if v.MaxReplies == 0 {
+		v.MaxReplies = defaultMaxReplies
+	}
+	if v.WindowSeconds == 0 {
+		v.WindowSeconds = int(defaultWindow.Seconds())
+	}
+	if v.Enabled == nil {
+		enabled := true
+		v.Enabled = &enabled
+	}
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "number", Field: v.Number, Message: fmt.Sprintf("%s is missing", "number")},
+		&validators.StringLengthInRange{Name: "number", Field: v.Number, Min: 6, Max: 16, Message: fmt.Sprintf("%s is invalid", "number")},
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%s is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Min: 1, Max: 64, Message: fmt.Sprintf("%s is invalid", "name")},
+		&validators.StringIsPresent{Name: "pattern", Field: v.Pattern, Message: fmt.Sprintf("%s is missing", "pattern")},
+		&validators.StringLengthInRange{Name: "pattern", Field: v.Pattern, Min: 1, Max: 256, Message: fmt.Sprintf("%s is invalid", "pattern")},
+		&validators.StringIsPresent{Name: "reply", Field: v.Reply, Message: fmt.Sprintf("%s is missing", "reply")},
+		&validators.IntIsGreaterThan{Name: "max_replies", Field: v.MaxReplies, Compared: 0, Message: fmt.Sprintf("%s is invalid", "max_replies")},
+		&validators.IntIsGreaterThan{Name: "window_seconds", Field: v.WindowSeconds, Compared: 0, Message: fmt.Sprintf("%s is invalid", "window_seconds")},
+		&validators.IntIsLessThan{Name: "window_seconds", Field: v.WindowSeconds, Compared: int(maxWindow.Seconds()) + 1, Message: fmt.Sprintf("window_seconds may be at most %d", int(maxWindow.Seconds()))},
+	)
+
+	switch v.MatchType {
+	case MatchKeyword:
+		v.Pattern = strings.TrimSpace(v.Pattern)
+	case MatchRegex:
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			err1.Add("pattern", err.Error())
+		}
+	default:
+		err1.Add("match_type", fmt.Sprintf("match_type must be %s or %s", MatchKeyword, MatchRegex))
+	}
+
+	if v.Tag != nil && (*v.Tag == "" || len(*v.Tag) > 64) {
+		err1.Add("tag", "tag is invalid")
+	}
+
+	// replies are sent as single messages
+	if length, gsm7 := pkg.SMSLength(v.Reply); gsm7 && length > pkg.MaxGSM7Length {
+		err1.Add("reply", fmt.Sprintf("reply may be at most %d characters", pkg.MaxGSM7Length))
+	} else if !gsm7 && length > pkg.MaxUCS2Length {
+		err1.Add("reply", fmt.Sprintf("reply may be at most %d characters when it uses characters outside the GSM alphabet", pkg.MaxUCS2Length))
+	}
+
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
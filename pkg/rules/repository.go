@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	create(ctx context.Context, accountId int64, req RuleReq) (*Rule, error)
+	list(ctx context.Context, accountId int64) ([]Rule, error)
+	update(ctx context.Context, id, accountId int64, req RuleReq) (*Rule, error)
+	delete(ctx context.Context, id, accountId int64) (bool, error)
+	ownsNumber(ctx context.Context, accountId int64, number string) (bool, error)
+	forNumber(ctx context.Context, accountId int64, number string) ([]Rule, error)
+	allowReply(ctx context.Context, rule Rule, remote string) (bool, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+func (r repository) create(ctx context.Context, accountId int64, req RuleReq) (*Rule, error) {
+	var rule Rule
+	err := r.db.GetContext(ctx, &rule, `INSERT INTO auto_reply_rule
+		(account_id, number, name, match_type, pattern, reply, tag, priority, max_replies, window_seconds, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING *`,
+		accountId, req.Number, req.Name, req.MatchType, req.Pattern, req.Reply, req.Tag, req.Priority,
+		req.MaxReplies, req.WindowSeconds, *req.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r repository) list(ctx context.Context, accountId int64) ([]Rule, error) {
+	rules := []Rule{}
+	err := r.db.SelectContext(ctx, &rules, `SELECT * FROM auto_reply_rule WHERE account_id = $1
+		ORDER BY number, priority DESC, id`, accountId)
+	return rules, err
+}
+
+// update returns nil when the account has no such rule.
+func (r repository) update(ctx context.Context, id, accountId int64, req RuleReq) (*Rule, error) {
+	var rule Rule
+	err := r.db.GetContext(ctx, &rule, `UPDATE auto_reply_rule SET number = $1, name = $2, match_type = $3,
+		pattern = $4, reply = $5, tag = $6, priority = $7, max_replies = $8, window_seconds = $9, enabled = $10,
+		updated_at = now()
+		WHERE id = $11 AND account_id = $12 RETURNING *`,
+		req.Number, req.Name, req.MatchType, req.Pattern, req.Reply, req.Tag, req.Priority,
+		req.MaxReplies, req.WindowSeconds, *req.Enabled, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r repository) delete(ctx context.Context, id, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM auto_reply_rule WHERE id = $1 AND account_id = $2`, id, accountId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r repository) ownsNumber(ctx context.Context, accountId int64, number string) (bool, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT count(id) FROM phone_number WHERE account_id = $1 AND number = $2", accountId, number)
+	return count > 0, err
+}
+
+// forNumber returns the enabled rules of number, highest priority first.
+func (r repository) forNumber(ctx context.Context, accountId int64, number string) ([]Rule, error) {
+	var rules []Rule
+	err := r.db.SelectContext(ctx, &rules, `SELECT * FROM auto_reply_rule
+		WHERE account_id = $1 AND number = $2 AND enabled
+		ORDER BY priority DESC, id`, accountId, number)
+	return rules, err
+}
+
+// allowReply counts a reply of rule to remote and reports whether it is
+// within the rule's limit. The window starts with the first reply.
+func (r repository) allowReply(ctx context.Context, rule Rule, remote string) (bool, error) {
+	key := fmt.Sprintf("auto_reply:%d:%s", rule.ID, remote)
+
+	n, err := r.rd.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if n == 1 {
+		err := r.rd.Expire(ctx, key, time.Duration(rule.WindowSeconds)*time.Second).Err()
+		if err != nil {
+			return false, err
+		}
+	}
+	return n <= int64(rule.MaxReplies), nil
+}
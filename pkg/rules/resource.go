@@ -0,0 +1,45 @@
+package rules
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/olusolaa/go-backend/pkg/contacts"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/olusolaa/go-backend/pkg/templates"
+)
+
+type Resource struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, rd *redis.Client) *Resource {
+	return &Resource{
+		db: db,
+		rd: rd,
+	}
+}
+
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db, rs.rd)
+	contactsSvc := contacts.NewService(contacts.NewRepository(rs.db, rs.rd))
+	svc := NewService(repo,
+		outbounds.NewService(outbounds.NewRepository(rs.db, rs.rd),
+			templates.NewService(templates.NewRepository(rs.db, rs.rd)),
+			contactsSvc,
+		),
+		contactsSvc,
+	)
+	hndlr := NewHandler(svc)
+
+	r.Get("/", hndlr.list)
+	r.Post("/", hndlr.create)
+	r.Put("/{id}", hndlr.update)
+	r.Delete("/{id}", hndlr.delete)
+
+	return r
+}
@@ -0,0 +1,155 @@
+package rules
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/olusolaa/go-backend/pkg/outbounds"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	create(ctx context.Context, req RuleReq) (*Rule, error)
+	list(ctx context.Context) ([]Rule, error)
+	update(ctx context.Context, id int64, req RuleReq) (*Rule, error)
+	delete(ctx context.Context, id int64) error
+	// Respond replies to an inbound message with the first of the
+	// receiving number's rules it matches, if any.
+	Respond(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) error
+}
+
+// Sender sends the replies.
+type Sender interface {
+	Send(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (*outbounds.Message, error)
+}
+
+// Tagger tags the contacts that trigger a rule.
+type Tagger interface {
+	Tag(ctx context.Context, accountId int64, number, tag string) error
+}
+
+type service struct {
+	repo   Repository
+	sender Sender
+	tagger Tagger
+}
+
+func NewService(repo Repository, sender Sender, tagger Tagger) Service {
+	svc := &service{
+		repo:   repo,
+		sender: sender,
+		tagger: tagger,
+	}
+	return svc
+}
+
+func notFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no rule with id %d", id))
+}
+
+func (s service) checkNumber(ctx context.Context, accountId int64, number string) error {
+	ok, err := s.repo.ownsNumber(ctx, accountId, number)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkg.WithStatus(http.StatusUnprocessableEntity, errors.New("number parameter not found"))
+	}
+	return nil
+}
+
+func (s service) create(ctx context.Context, req RuleReq) (*Rule, error) {
+	accountId := pkg.AccountID(ctx)
+	if err := s.checkNumber(ctx, accountId, req.Number); err != nil {
+		return nil, err
+	}
+	return s.repo.create(ctx, accountId, req)
+}
+
+func (s service) list(ctx context.Context) ([]Rule, error) {
+	return s.repo.list(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) update(ctx context.Context, id int64, req RuleReq) (*Rule, error) {
+	accountId := pkg.AccountID(ctx)
+	if err := s.checkNumber(ctx, accountId, req.Number); err != nil {
+		return nil, err
+	}
+
+	rule, err := s.repo.update(ctx, id, accountId, req)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, notFound(id)
+	}
+	return rule, nil
+}
+
+func (s service) delete(ctx context.Context, id int64) error {
+	ok, err := s.repo.delete(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound(id)
+	}
+	return nil
+}
+
+// Respond is called once the receiving number is known to belong to the
+// account. STOP is never answered: it already blocks replies to the sender.
+func (s service) Respond(ctx context.Context, accountId int64, req pkg.PostReq, allow func(pkg.PostReq) (bool, error)) (err error) {
+	if req.Text == "stop" {
+		return nil
+	}
+
+	ctx, span := pkg.StartSpan(ctx, "rules.service.Respond",
+		pkg.AttrAccountID.Int64(accountId),
+		pkg.AttrDirection.String("inbound"),
+	)
+	defer func() { pkg.EndSpan(span, err) }()
+
+	rules, err := s.repo.forNumber(ctx, accountId, req.To)
+	if err != nil {
+		return err
+	}
+
+	var rule *Rule
+	for i := range rules {
+		if rules[i].matches(req.Text) {
+			rule = &rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil
+	}
+
+	log := pkg.Logger(ctx).WithFields(pkg.SMSFields(req)).WithField("rule_id", rule.ID)
+
+	ok, err := s.repo.allowReply(ctx, *rule, req.From)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Info("auto-reply limit reached")
+		return nil
+	}
+
+	if rule.Tag != nil {
+		if err := s.tagger.Tag(ctx, accountId, req.From, *rule.Tag); err != nil {
+			return err
+		}
+	}
+
+	// the reply goes through the same checks as any outbound message
+	reply := pkg.PostReq{From: req.To, To: req.From, Text: rule.Reply}
+	if _, err := s.sender.Send(ctx, accountId, reply, allow); err != nil {
+		return errors.Wrapf(err, "rule %d", rule.ID)
+	}
+	log.Info("auto-reply sent")
+	return nil
+}
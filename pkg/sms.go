@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Single message limits: 160 characters when the text fits the GSM 03.38
+// alphabet, 70 when it has to be sent as UCS-2.
+const (
+	MaxGSM7Length = 160
+	MaxUCS2Length = 70
+)
+
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	// extension characters take two septets
+	gsm7Extended = "^{}\\[~]|€\f"
+)
+
+// SMSLength returns the length of text as counted against the single
+// message limit, and whether it can be sent in the GSM 7 bit alphabet.
+func SMSLength(text string) (length int, gsm7 bool) {
+	for _, c := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, c):
+			length++
+		case strings.ContainsRune(gsm7Extended, c):
+			length += 2
+		default:
+			return len(utf16.Encode([]rune(text))), false
+		}
+	}
+	return length, true
+}
@@ -0,0 +1,43 @@
+package templates
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"net/http"
+	"time"
+)
+
+// maxBodyLength bounds template bodies; the rendered text is checked
+// against the sms limits separately.
+const maxBodyLength = 1600
+
+// Template is the current version of an account's message template.
+type Template struct {
+	ID        int64     `json:"id" db:"id"`
+	AccountID int64     `json:"-" db:"account_id"`
+	Name      string    `json:"name" db:"name"`
+	Version   int       `json:"version" db:"version"`
+	Body      string    `json:"body" db:"body"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TemplateReq creates a template or, on update, its next version.
+type TemplateReq struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
+
+func (v *TemplateReq) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%s is missing", "name")},
+		&validators.StringIsPresent{Name: "body", Field: v.Body, Message: fmt.Sprintf("%s is missing", "body")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Min: 1, Max: 64, Message: fmt.Sprintf("%s is invalid", "name")},
+		&validators.StringLengthInRange{Name: "body", Field: v.Body, Min: 1, Max: maxBodyLength, Message: fmt.Sprintf("%s is invalid", "body")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package templates
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholder matches {{name}}, allowing spaces inside the braces.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// Render substitutes every {{name}} placeholder in body with vars[name].
+// Values are inserted as is and never parsed as placeholders themselves.
+// It fails listing every placeholder vars has no value for, and when the
+// text is blank once rendered, since a template message's text is only
+// checked for presence after rendering.
+func Render(body string, vars map[string]string) (string, error) {
+	var missing []string
+	seen := map[string]bool{}
+
+	out := placeholder.ReplaceAllStringFunc(body, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			if !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+			return m
+		}
+		return v
+	})
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", errors.Errorf("missing template variables: %s", strings.Join(missing, ", "))
+	}
+	if strings.TrimSpace(out) == "" {
+		return "", errors.New("template renders to empty text")
+	}
+	return out, nil
+}
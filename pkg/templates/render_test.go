@@ -0,0 +1,73 @@
+package templates
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		vars    map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "variables",
+			body: "Hi {{name}}, your code is {{ code }}. Bye {{name}}",
+			vars: map[string]string{"name": "Ada", "code": "1234"},
+			want: "Hi Ada, your code is 1234. Bye Ada",
+		},
+		{
+			name: "values are not parsed",
+			body: "Hi {{name}}",
+			vars: map[string]string{"name": "{{code}}"},
+			want: "Hi {{code}}",
+		},
+		{
+			name: "empty variable in text",
+			body: "Hi {{name}}!",
+			vars: map[string]string{"name": ""},
+			want: "Hi !",
+		},
+		{
+			name:    "missing variables",
+			body:    "{{b}} {{a}} {{b}} {{c}}",
+			vars:    map[string]string{"c": "x"},
+			wantErr: "missing template variables: a, b",
+		},
+		{
+			name:    "no variables given",
+			body:    "Hi {{name}}",
+			wantErr: "missing template variables: name",
+		},
+		{
+			name:    "empty variables",
+			body:    "{{greeting}}",
+			vars:    map[string]string{"greeting": ""},
+			wantErr: "template renders to empty text",
+		},
+		{
+			name:    "blank variables",
+			body:    "{{greeting}} {{name}}",
+			vars:    map[string]string{"greeting": " ", "name": "\n"},
+			wantErr: "template renders to empty text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.body, tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Render = %q, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package templates
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	_ Repository = repository{} // Verify that repository implements Repository.
+)
+
+type Repository interface {
+	create(ctx context.Context, accountId int64, req TemplateReq) (*Template, error)
+	list(ctx context.Context, accountId int64) ([]Template, error)
+	find(ctx context.Context, id, accountId int64) (*Template, error)
+	update(ctx context.Context, id, accountId int64, req TemplateReq) (*Template, error)
+	delete(ctx context.Context, id, accountId int64) (bool, error)
+}
+
+type repository struct {
+	db *sqlx.DB
+	rd *redis.Client
+}
+
+func NewRepository(db *sqlx.DB, rd *redis.Client) Repository {
+	return &repository{db: db, rd: rd}
+}
+
+const selectTemplate = `SELECT t.id, t.account_id, t.name, t.version, v.body, t.created_at, t.updated_at
+	FROM message_template t
+	JOIN message_template_version v ON v.template_id = t.id AND v.version = t.version
+	WHERE t.deleted_at IS NULL`
+
+func (r repository) create(ctx context.Context, accountId int64, req TemplateReq) (*Template, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.GetContext(ctx, &id, `INSERT INTO message_template (account_id, name, version)
+		VALUES ($1, $2, 1) RETURNING id`, accountId, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO message_template_version (template_id, version, body)
+		VALUES ($1, 1, $2)`, id, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.find(ctx, id, accountId)
+}
+
+func (r repository) list(ctx context.Context, accountId int64) ([]Template, error) {
+	tmpls := []Template{}
+	err := r.db.SelectContext(ctx, &tmpls, selectTemplate+` AND t.account_id = $1 ORDER BY t.id`, accountId)
+	return tmpls, err
+}
+
+// find returns nil when the account has no such template.
+func (r repository) find(ctx context.Context, id, accountId int64) (*Template, error) {
+	var t Template
+	err := r.db.GetContext(ctx, &t, selectTemplate+` AND t.id = $1 AND t.account_id = $2`, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// update stores req as the next version of the template. Earlier versions
+// are kept so sent messages can still be traced to the text they used.
+func (r repository) update(ctx context.Context, id, accountId int64, req TemplateReq) (*Template, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.GetContext(ctx, &version, `UPDATE message_template SET version = version + 1, name = $1, updated_at = now()
+		WHERE id = $2 AND account_id = $3 AND deleted_at IS NULL RETURNING version`, req.Name, id, accountId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO message_template_version (template_id, version, body)
+		VALUES ($1, $2, $3)`, id, version, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.find(ctx, id, accountId)
+}
+
+// delete hides the template; its versions stay for messages that used it.
+func (r repository) delete(ctx context.Context, id, accountId int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE message_template SET deleted_at = now()
+		WHERE id = $1 AND account_id = $2 AND deleted_at IS NULL`, id, accountId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
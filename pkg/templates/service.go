@@ -0,0 +1,81 @@
+package templates
+
+import (
+	"context"
+	"github.com/olusolaa/go-backend/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+var _ Service = service{} // Verify that service implements Service.
+
+type Service interface {
+	create(ctx context.Context, req TemplateReq) (*Template, error)
+	list(ctx context.Context) ([]Template, error)
+	update(ctx context.Context, id int64, req TemplateReq) (*Template, error)
+	delete(ctx context.Context, id int64) error
+	// Render renders the current version of an account's template and
+	// returns the text with the version it came from.
+	Render(ctx context.Context, accountId, id int64, vars map[string]string) (string, int, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	svc := &service{
+		repo: repo,
+	}
+	return svc
+}
+
+func notFound(id int64) error {
+	return pkg.WithStatus(http.StatusNotFound, errors.Errorf("no template with id %d", id))
+}
+
+func (s service) create(ctx context.Context, req TemplateReq) (*Template, error) {
+	return s.repo.create(ctx, pkg.AccountID(ctx), req)
+}
+
+func (s service) list(ctx context.Context) ([]Template, error) {
+	return s.repo.list(ctx, pkg.AccountID(ctx))
+}
+
+func (s service) update(ctx context.Context, id int64, req TemplateReq) (*Template, error) {
+	t, err := s.repo.update(ctx, id, pkg.AccountID(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, notFound(id)
+	}
+	return t, nil
+}
+
+func (s service) delete(ctx context.Context, id int64) error {
+	ok, err := s.repo.delete(ctx, id, pkg.AccountID(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound(id)
+	}
+	return nil
+}
+
+func (s service) Render(ctx context.Context, accountId, id int64, vars map[string]string) (string, int, error) {
+	t, err := s.repo.find(ctx, id, accountId)
+	if err != nil {
+		return "", 0, err
+	}
+	if t == nil {
+		return "", 0, notFound(id)
+	}
+
+	text, err := Render(t.Body, vars)
+	if err != nil {
+		return "", 0, pkg.WithStatus(http.StatusUnprocessableEntity, err)
+	}
+	return text, t.Version, nil
+}
@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+const tracerName = "github.com/olusolaa/go-backend"
+
+// Span attributes shared by the sms handlers.
+const (
+	AttrAccountID = attribute.Key("sms.account_id")
+	AttrDirection = attribute.Key("sms.direction")
+	AttrResult    = attribute.Key("sms.result")
+	AttrRequestID = attribute.Key("http.request_id")
+)
+
+// StartSpan starts a child span of whatever span is carried by ctx.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the outcome of the traced call and ends the span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(AttrResult.String("error"))
+	} else {
+		span.SetAttributes(AttrResult.String("ok"))
+	}
+	span.End()
+}
+
+// Detach returns a context with the values of ctx, its span and logger
+// included, that is never cancelled, for cleanup that must run even once
+// the client of the request has gone.
+func Detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// RedisTracer traces every command and pipeline of the redis client it is
+// added to as a child of the span of the command's context. A missing key
+// (redis.Nil) is a normal outcome and is not recorded as an error.
+type RedisTracer struct{}
+
+var _ redis.Hook = RedisTracer{}
+
+func (RedisTracer) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, "redis "+cmd.Name(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationKey.String(cmd.Name())),
+	)
+	return ctx, nil
+}
+
+func (RedisTracer) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(trace.SpanFromContext(ctx), cmd.Err())
+	return nil
+}
+
+func (RedisTracer) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, "redis pipeline",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBStatementKey.String(strings.Join(names, " "))),
+	)
+	return ctx, nil
+}
+
+func (RedisTracer) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && err != redis.Nil {
+			break
+		}
+	}
+	endRedisSpan(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+func endRedisSpan(span trace.Span, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	EndSpan(span, err)
+}